@@ -0,0 +1,79 @@
+package circuit
+
+import (
+	"merkleverifytool/merkle_groth16/src/utils"
+
+	"github.com/consensys/gnark/std/hash/poseidon"
+)
+
+// CexSummaryCircuit proves the cex state after the last batch. Its public inputs are the
+// GroupCommitment of the last batch proof together with the final account tree root, the
+// per-asset totals and prices and the total equity and debt, so the published liabilities
+// are bound to the batch proofs without relying on the off-circuit CexAssetsInfo config.
+type CexSummaryCircuit struct {
+	GroupCommitment  Variable       `gnark:",public"`
+	NextSMTRoot      Variable       `gnark:",public"`
+	TotalEquity      Variable       `gnark:",public"`
+	TotalDebt        Variable       `gnark:",public"`
+	CexAssets        []CexAssetInfo `gnark:",public"`
+	PreSMTRoot       Variable
+	PreCEXCommitment Variable
+}
+
+func NewCexSummaryCircuit(assetCounts uint32) *CexSummaryCircuit {
+	var circuit CexSummaryCircuit
+	circuit.GroupCommitment = 0
+	circuit.NextSMTRoot = 0
+	circuit.TotalEquity = 0
+	circuit.TotalDebt = 0
+	circuit.PreSMTRoot = 0
+	circuit.PreCEXCommitment = 0
+	circuit.CexAssets = make([]CexAssetInfo, assetCounts)
+	for i := uint32(0); i < assetCounts; i++ {
+		circuit.CexAssets[i].TotalBalance = 0
+		circuit.CexAssets[i].BasePrice = 0
+	}
+	return &circuit
+}
+
+func (b CexSummaryCircuit) Define(api API) error {
+	balances := make([]Variable, len(b.CexAssets))
+	prices := make([]Variable, len(b.CexAssets))
+	for i := 0; i < len(b.CexAssets); i++ {
+		balances[i] = b.CexAssets[i].TotalBalance
+		prices[i] = b.CexAssets[i].BasePrice
+	}
+	CheckValueInRange(api, b.TotalEquity)
+	CheckValueInRange(api, b.TotalDebt)
+	api.AssertIsLessOrEqual(b.TotalDebt, b.TotalEquity)
+	nextCexCommitment := ComputeCexAssetsCommitment(api, balances, prices, b.TotalEquity, b.TotalDebt)
+	actualBatchCommitment := poseidon.Poseidon(api, b.PreSMTRoot, b.NextSMTRoot, b.PreCEXCommitment, nextCexCommitment)
+	api.AssertIsEqual(b.GroupCommitment, actualBatchCommitment)
+	return nil
+}
+
+// SetCexSummaryCircuitWitness builds the summary witness from the last batch witness.
+func SetCexSummaryCircuitWitness(batchWitness *utils.BatchCreateUserWitness) (witness *CexSummaryCircuit, err error) {
+	cexAssets := utils.RecoverAfterCexAssets(batchWitness)
+	witness = NewVerifyCexSummaryCircuit(batchWitness.BatchCommitment, batchWitness.AfterAccountTreeRoot,
+		batchWitness.TotalCexAssets.AfterCEXTotalEquity, batchWitness.TotalCexAssets.AfterCEXTotalDebt, cexAssets)
+	witness.PreSMTRoot = batchWitness.BeforeAccountTreeRoot
+	witness.PreCEXCommitment = batchWitness.BeforeCEXAssetsCommitment
+	return witness, nil
+}
+
+// NewVerifyCexSummaryCircuit sets the public inputs of the summary circuit.
+func NewVerifyCexSummaryCircuit(commitment []byte, accountTreeRoot []byte, totalEquity uint64, totalDebt uint64,
+	cexAssets []utils.CexAssetInfo) *CexSummaryCircuit {
+	var v CexSummaryCircuit
+	v.GroupCommitment = commitment
+	v.NextSMTRoot = accountTreeRoot
+	v.TotalEquity = totalEquity
+	v.TotalDebt = totalDebt
+	v.CexAssets = make([]CexAssetInfo, len(cexAssets))
+	for i := 0; i < len(cexAssets); i++ {
+		v.CexAssets[i].TotalBalance = cexAssets[i].TotalBalance
+		v.CexAssets[i].BasePrice = cexAssets[i].BasePrice
+	}
+	return &v
+}
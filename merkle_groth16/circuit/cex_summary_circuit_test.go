@@ -0,0 +1,72 @@
+package circuit
+
+import (
+	"testing"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+// newTestCexSummaryAssets is utils.RecoverAfterCexAssets for testAssetCounts assets.
+func newTestCexSummaryAssets(batchWitness *utils.BatchCreateUserWitness) []utils.CexAssetInfo {
+	cexAssets := make([]utils.CexAssetInfo, len(batchWitness.BeforeCexAssets))
+	copy(cexAssets, batchWitness.BeforeCexAssets)
+	for i := 0; i < len(batchWitness.CreateUserOps); i++ {
+		for j := 0; j < len(batchWitness.CreateUserOps[i].Assets); j++ {
+			asset := batchWitness.CreateUserOps[i].Assets[j]
+			cexAssets[asset.Index].TotalBalance += asset.Balance
+		}
+	}
+	return cexAssets
+}
+
+func newTestCexSummaryPublicWitness(batchWitness *utils.BatchCreateUserWitness) *CexSummaryCircuit {
+	return NewVerifyCexSummaryCircuit(batchWitness.BatchCommitment, batchWitness.AfterAccountTreeRoot,
+		batchWitness.TotalCexAssets.AfterCEXTotalEquity, batchWitness.TotalCexAssets.AfterCEXTotalDebt,
+		newTestCexSummaryAssets(batchWitness))
+}
+
+// newTestCexSummaryWitness is SetCexSummaryCircuitWitness for testAssetCounts assets.
+func newTestCexSummaryWitness(batchWitness *utils.BatchCreateUserWitness) *CexSummaryCircuit {
+	witness := newTestCexSummaryPublicWitness(batchWitness)
+	witness.PreSMTRoot = batchWitness.BeforeAccountTreeRoot
+	witness.PreCEXCommitment = batchWitness.BeforeCEXAssetsCommitment
+	return witness
+}
+
+func TestCexSummaryCircuit(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewCexSummaryCircuit(testAssetCounts)
+	batchWitness := newTestBatchWitness(t, []int64{163, 5, -9, 0}, newValidTestAccounts())
+
+	witness := newTestCexSummaryWitness(batchWitness)
+	assert.SolvingSucceeded(circuit, witness, testOptions()...)
+	publicWitness, err := frontend.NewWitness(newTestCexSummaryPublicWitness(batchWitness), ecc.BN254, frontend.PublicOnly())
+	assert.NoError(err)
+	// group commitment, root, equity, debt and a balance and price per asset
+	assert.Equal(4+2*testAssetCounts, publicWitness.Schema.NbPublic)
+
+	witness = newTestCexSummaryWitness(batchWitness)
+	witness.TotalDebt = batchWitness.TotalCexAssets.AfterCEXTotalDebt - 1
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	witness = newTestCexSummaryWitness(batchWitness)
+	witness.CexAssets[1].TotalBalance = 0
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	// the sign of a balance is committed, asset 2 totals -16
+	witness = newTestCexSummaryWitness(batchWitness)
+	witness.CexAssets[2].TotalBalance = 16
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	witness = newTestCexSummaryWitness(batchWitness)
+	witness.CexAssets[0].BasePrice = 0
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	witness = newTestCexSummaryWitness(batchWitness)
+	witness.NextSMTRoot = batchWitness.BeforeAccountTreeRoot
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+}
@@ -1,8 +1,21 @@
 package circuit
 
-import "math/big"
+import (
+	"math/big"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+const (
+	// SignedValueBits is the bit width of per-asset balances, both for users and
+	// for the cex totals. It matches the int64 used off-circuit.
+	SignedValueBits = 64
+	// PriceRemainderBits bounds the remainder of dividing a price weighted sum by
+	// utils.PriceMultiplier, 2^27 > 1e8
+	PriceRemainderBits = 27
+)
 
 var (
-	//  is poseidon hash(empty account info)
-	EmptyAccountLeafNodeHash, _ = new(big.Int).SetString("0cc1c37a517c3b8db148653c41b15dc7f0136dc284fb2818adf26669d897298c", 16)
+	// EmptyAccountLeafNodeHash is poseidon hash(empty account info), see utils.NilAccountHash
+	EmptyAccountLeafNodeHash = new(big.Int).SetBytes(utils.NilAccountHash)
 )
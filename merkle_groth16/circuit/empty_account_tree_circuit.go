@@ -0,0 +1,56 @@
+package circuit
+
+import "github.com/consensys/gnark/std/hash/poseidon"
+
+// EmptyAccountTreeCircuit derives the leaf of an account without balances and the root of
+// the account tree without accounts with the hashing of the batch circuits, and checks them
+// against EmptyAccountLeafNodeHash and its public inputs. It is only solved by the selftest,
+// so that utils.NilAccountHash and the account tree are checked against the circuit side.
+type EmptyAccountTreeCircuit struct {
+	NilAccountHash       Variable `gnark:",public"`
+	EmptyAccountTreeRoot Variable `gnark:",public"`
+	AssetCounts          int      `gnark:"-"`
+	AccountTreeDepth     int      `gnark:"-"`
+}
+
+func NewEmptyAccountTreeCircuit(assetCounts int, accountTreeDepth int) *EmptyAccountTreeCircuit {
+	return &EmptyAccountTreeCircuit{
+		NilAccountHash:       0,
+		EmptyAccountTreeRoot: 0,
+		AssetCounts:          assetCounts,
+		AccountTreeDepth:     accountTreeDepth,
+	}
+}
+
+// NewVerifyEmptyAccountTreeCircuit sets the leaf and root the circuit derives are checked against.
+func NewVerifyEmptyAccountTreeCircuit(nilAccountHash []byte, emptyAccountTreeRoot []byte) *EmptyAccountTreeCircuit {
+	return &EmptyAccountTreeCircuit{
+		NilAccountHash:       nilAccountHash,
+		EmptyAccountTreeRoot: emptyAccountTreeRoot,
+	}
+}
+
+func (b EmptyAccountTreeCircuit) Define(api API) error {
+	// the empty slots are the assets in index order, as utils.PaddingAccountAssets pads them
+	emptyAssets := make([]UserAssetInfo, b.AssetCounts)
+	for i := 0; i < b.AssetCounts; i++ {
+		emptyAssets[i].AssetIndex = i
+		emptyAssets[i].Balance = 0
+	}
+	emptyAssetsCommitment := ComputeUserAssetsCommitment(api, emptyAssets)
+	leaf := poseidon.Poseidon(api, 0, 0, 0, emptyAssetsCommitment)
+	api.AssertIsEqual(leaf, EmptyAccountLeafNodeHash)
+	api.AssertIsEqual(leaf, b.NilAccountHash)
+
+	// every sibling of the path to the first leaf is an empty subtree
+	proofSet := make([]Variable, b.AccountTreeDepth)
+	helper := make([]Variable, b.AccountTreeDepth)
+	node := leaf
+	for i := 0; i < b.AccountTreeDepth; i++ {
+		proofSet[i] = node
+		helper[i] = 0
+		node = poseidon.Poseidon(api, node, node)
+	}
+	VerifyMerkleProof(api, b.EmptyAccountTreeRoot, leaf, proofSet, helper)
+	return nil
+}
@@ -0,0 +1,29 @@
+package circuit
+
+import (
+	"testing"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+
+	"github.com/consensys/gnark/test"
+)
+
+func TestEmptyAccountTreeCircuit(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewEmptyAccountTreeCircuit(utils.AssetCounts, utils.AccountTreeDepth)
+
+	witness := NewVerifyEmptyAccountTreeCircuit(utils.NilAccountHash, utils.EmptyAccountTreeRoot)
+	assert.SolvingSucceeded(circuit, witness, testOptions()...)
+
+	// the leaf and root of another circuit profile
+	otherLeaf := utils.ComputeNilAccountHash(utils.AssetCounts - 1)
+	witness = NewVerifyEmptyAccountTreeCircuit(otherLeaf, utils.ComputeEmptyAccountTreeRoot(otherLeaf, utils.AccountTreeDepth))
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	witness = NewVerifyEmptyAccountTreeCircuit(utils.NilAccountHash, utils.ComputeEmptyAccountTreeRoot(utils.NilAccountHash, utils.AccountTreeDepth-1))
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	// the circuit doesn't derive EmptyAccountLeafNodeHash for other asset counts
+	witness = NewVerifyEmptyAccountTreeCircuit(otherLeaf, utils.ComputeEmptyAccountTreeRoot(otherLeaf, utils.AccountTreeDepth))
+	assert.SolvingFailed(NewEmptyAccountTreeCircuit(utils.AssetCounts-1, utils.AccountTreeDepth), witness, testOptions()...)
+}
@@ -1,6 +1,7 @@
 package circuit
 
 import (
+	"math/big"
 	"merkleverifytool/merkle_groth16/src/utils"
 
 	"github.com/consensys/gnark/std/hash/poseidon"
@@ -13,6 +14,7 @@ type GroupUserCircuit struct {
 	PreCEXCommitment  Variable
 	NextCEXCommitment Variable
 	PreCexAssets      []CexAssetInfo
+	NextCexAssets     []Variable // balances after the batch, the prices are those of PreCexAssets
 	TotalCexAssets    CexAssetsInfo
 	UserInstructions  []UserInstruction
 }
@@ -23,7 +25,9 @@ func NewVerifyBatchCreateUserCircuit(commitment []byte) *GroupUserCircuit {
 	return &v
 }
 
-func NewBatchCreateUserCircuit(assetCounts uint32, batchCounts uint32) *GroupUserCircuit {
+// NewBatchCreateUserCircuit returns the dense circuit if userAssetCounts equals assetCounts,
+// otherwise the sparse one with userAssetCounts asset slots per user.
+func NewBatchCreateUserCircuit(assetCounts uint32, userAssetCounts uint32, batchCounts uint32) *GroupUserCircuit {
 	var circuit GroupUserCircuit
 	circuit.GroupCommitment = 0
 	circuit.PreSMTRoot = 0
@@ -35,20 +39,23 @@ func NewBatchCreateUserCircuit(assetCounts uint32, batchCounts uint32) *GroupUse
 	circuit.TotalCexAssets.PreCEXTotalDebt = 0
 	circuit.TotalCexAssets.NextCEXTotalDebt = 0
 	circuit.PreCexAssets = make([]CexAssetInfo, assetCounts)
+	circuit.NextCexAssets = make([]Variable, assetCounts)
 	for i := uint32(0); i < assetCounts; i++ {
 		circuit.PreCexAssets[i].TotalBalance = 0
+		circuit.PreCexAssets[i].BasePrice = 0
+		circuit.NextCexAssets[i] = 0
 	}
 	circuit.UserInstructions = make([]UserInstruction, batchCounts)
 	for i := uint32(0); i < batchCounts; i++ {
 		circuit.UserInstructions[i] = UserInstruction{
 			PreSMTRoot:   0,
 			NextSMTRoot:  0,
-			Assets:       make([]Variable, assetCounts),
+			Assets:       make([]UserAssetInfo, userAssetCounts),
 			AccountIndex: 0,
 			AccountProof: [utils.AccountTreeDepth]Variable{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
 		}
-		for j := uint32(0); j < assetCounts; j++ {
-			circuit.UserInstructions[i].Assets[j] = 0
+		for j := uint32(0); j < userAssetCounts; j++ {
+			circuit.UserInstructions[i].Assets[j] = UserAssetInfo{AssetIndex: 0, Balance: 0}
 		}
 	}
 	return &circuit
@@ -60,11 +67,17 @@ func (b GroupUserCircuit) Define(api API) error {
 	api.AssertIsEqual(b.GroupCommitment, actualBatchCommitment)
 	cexAssets := make([]Variable, len(b.PreCexAssets))
 	afterCexAssets := make([]Variable, len(b.PreCexAssets))
+	assetPrices := make([]Variable, len(b.PreCexAssets))
 	for i := 0; i < len(b.PreCexAssets); i++ {
 		cexAssets[i] = b.PreCexAssets[i].TotalBalance
 		afterCexAssets[i] = b.PreCexAssets[i].TotalBalance //
+		assetPrices[i] = b.PreCexAssets[i].BasePrice
 	}
-	actualCexAssetsCommitment := ComputeUserAssetsCommitment(api, cexAssets)
+	isSparse := len(b.UserInstructions[0].Assets) < len(b.PreCexAssets)
+	// PreCexAssets and the prices are range checked by the commitment below. The same
+	// prices are committed in NextCEXCommitment, so they are fixed for the whole chain.
+	actualCexAssetsCommitment := ComputeCexAssetsCommitment(api, cexAssets, assetPrices,
+		b.TotalCexAssets.PreCEXTotalEquity, b.TotalCexAssets.PreCEXTotalDebt)
 	api.AssertIsEqual(b.PreCEXCommitment, actualCexAssetsCommitment)
 
 	api.AssertIsEqual(b.PreSMTRoot, b.UserInstructions[0].PreSMTRoot)
@@ -79,28 +92,68 @@ func (b GroupUserCircuit) Define(api API) error {
 	CheckValueInRange(api, b.TotalCexAssets.PreCEXTotalDebt)
 	CheckValueInRange(api, b.TotalCexAssets.PreCEXTotalEquity)
 
+	userAssetsCommitments := make([]Variable, len(b.UserInstructions))
+	userAssets := make([][]UserAssetInfo, len(b.UserInstructions))
+	userAssetIndexBits := make([][][]Variable, len(b.UserInstructions))
 	for i := 0; i < len(b.UserInstructions); i++ {
 		accountIndexHelper := AccountIdToMerkleHelper(api, b.UserInstructions[i].AccountIndex)
 		VerifyMerkleProof(api, b.UserInstructions[i].PreSMTRoot, EmptyAccountLeafNodeHash, b.UserInstructions[i].AccountProof[:], accountIndexHelper)
-		userAssets := b.UserInstructions[i].Assets //copy
+		userAssets[i] = b.UserInstructions[i].Assets
+		userAssetIndexBits[i] = CheckUserAssetIndexes(api, userAssets[i], len(b.PreCexAssets))
 
-		for j := 0; j < len(userAssets); j++ {
-			afterCexAssets[j] = api.Add(afterCexAssets[j], userAssets[j])
+		// every user asset is range checked to int64 by ComputeUserAssetsCommitmentAndValue, so
+		// afterCexAssets[j] is an exact integer sum of at most len(UserInstructions)+1
+		// int64 values and can't wrap around the field before its own range check below.
+		// The sparse slots are summed up by AssertIsAssetsDelta after the loop.
+		if !isSparse {
+			for j := 0; j < len(userAssets[i]); j++ {
+				afterCexAssets[j] = api.Add(afterCexAssets[j], userAssets[i][j].Balance)
+			}
 		}
 		tempTotalCexAssets.NextCEXTotalEquity = api.Add(tempTotalCexAssets.NextCEXTotalEquity, b.UserInstructions[i].TotalEquity)
 		tempTotalCexAssets.NextCEXTotalDebt = api.Add(tempTotalCexAssets.NextCEXTotalDebt, b.UserInstructions[i].TotalDebt)
 		api.AssertIsLessOrEqual(tempTotalCexAssets.NextCEXTotalDebt, tempTotalCexAssets.NextCEXTotalEquity)
 		CheckValueInRange(api, b.UserInstructions[i].TotalEquity)
 		CheckValueInRange(api, b.UserInstructions[i].TotalDebt)
-		userAssetsCommitment := ComputeUserAssetsCommitment(api, userAssets)
+		// TotalEquity and TotalDebt must be the price weighted sums of the positive and
+		// the negative asset balances, rounded down and up respectively
+		userAssetsCommitment, userEquity, userDebt := ComputeUserAssetsCommitmentAndValue(api, userAssets[i], assetPrices, userAssetIndexBits[i])
+		userAssetsCommitments[i] = userAssetsCommitment
+		AssertIsFloorDiv(api, b.UserInstructions[i].TotalEquity, userEquity)
+		AssertIsCeilDiv(api, b.UserInstructions[i].TotalDebt, userDebt)
 		accountHash := poseidon.Poseidon(api, b.UserInstructions[i].AccountIdHash, b.UserInstructions[i].TotalEquity, b.UserInstructions[i].TotalDebt, userAssetsCommitment)
 		actualAccountTreeRoot := UpdateMerkleProof(api, accountHash, b.UserInstructions[i].AccountProof[:], accountIndexHelper)
 		api.AssertIsEqual(actualAccountTreeRoot, b.UserInstructions[i].NextSMTRoot)
 	}
 	CheckValueInRange(api, tempTotalCexAssets.NextCEXTotalDebt)
+	CheckValueInRange(api, tempTotalCexAssets.NextCEXTotalEquity)
 	api.AssertIsEqual(tempTotalCexAssets.NextCEXTotalEquity, b.TotalCexAssets.NextCEXTotalEquity)
 	api.AssertIsEqual(tempTotalCexAssets.NextCEXTotalDebt, b.TotalCexAssets.NextCEXTotalDebt)
-	actualAfterCEXAssetsCommitment := ComputeUserAssetsCommitment(api, afterCexAssets)
+	if isSparse {
+		// the challenge binds the signed cex balances, which the cex commitments don't,
+		// and the user slots through their commitments
+		challengeInputs := make([]Variable, 0, 2*len(cexAssets)+len(userAssetsCommitments))
+		challengeInputs = append(challengeInputs, cexAssets...)
+		challengeInputs = append(challengeInputs, b.NextCexAssets...)
+		challengeInputs = append(challengeInputs, userAssetsCommitments...)
+		// the lazy poseidon doesn't support a last chunk of a single input
+		if len(challengeInputs)%12 == 1 {
+			challengeInputs = append(challengeInputs, 0)
+		}
+		r := poseidon.Poseidon(api, challengeInputs...)
+		deltas := make([]Variable, len(cexAssets))
+		for j := 0; j < len(cexAssets); j++ {
+			deltas[j] = api.Sub(b.NextCexAssets[j], cexAssets[j])
+		}
+		AssertIsAssetsDelta(api, r, deltas, userAssets, userAssetIndexBits)
+	} else {
+		for j := 0; j < len(afterCexAssets); j++ {
+			api.AssertIsEqual(afterCexAssets[j], b.NextCexAssets[j])
+		}
+	}
+	// range check the per-asset cex totals, mirrors SafeAddInt64 in the witness service
+	actualAfterCEXAssetsCommitment := ComputeCexAssetsCommitment(api, b.NextCexAssets, assetPrices,
+		b.TotalCexAssets.NextCEXTotalEquity, b.TotalCexAssets.NextCEXTotalDebt)
 	api.AssertIsEqual(actualAfterCEXAssetsCommitment, b.NextCEXCommitment)
 	for i := 0; i < len(b.UserInstructions)-1; i++ {
 		api.AssertIsEqual(b.UserInstructions[i].NextSMTRoot, b.UserInstructions[i+1].PreSMTRoot)
@@ -117,6 +170,7 @@ func SetBatchCreateUserCircuitWitness(batchWitness *utils.BatchCreateUserWitness
 		PreCEXCommitment:  batchWitness.BeforeCEXAssetsCommitment,
 		NextCEXCommitment: batchWitness.AfterCEXAssetsCommitment,
 		PreCexAssets:      make([]CexAssetInfo, len(batchWitness.BeforeCexAssets)),
+		NextCexAssets:     make([]Variable, len(batchWitness.BeforeCexAssets)),
 		UserInstructions:  make([]UserInstruction, len(batchWitness.CreateUserOps)),
 	}
 	witness.TotalCexAssets.PreCEXTotalEquity = batchWitness.TotalCexAssets.BeforeCEXTotalEquity
@@ -126,19 +180,31 @@ func SetBatchCreateUserCircuitWitness(batchWitness *utils.BatchCreateUserWitness
 
 	for i := 0; i < len(witness.PreCexAssets); i++ {
 		witness.PreCexAssets[i].TotalBalance = batchWitness.BeforeCexAssets[i].TotalBalance //___
-
+		witness.PreCexAssets[i].BasePrice = batchWitness.BeforeCexAssets[i].BasePrice
+	}
+	// summed up without overflow checks, the circuit rejects totals out of the int64 range
+	afterCexAssets := make([]*big.Int, len(witness.NextCexAssets))
+	for i := 0; i < len(afterCexAssets); i++ {
+		afterCexAssets[i] = big.NewInt(batchWitness.BeforeCexAssets[i].TotalBalance)
+	}
+	for i := 0; i < len(batchWitness.CreateUserOps); i++ {
+		for _, asset := range batchWitness.CreateUserOps[i].Assets {
+			afterCexAssets[asset.Index].Add(afterCexAssets[asset.Index], big.NewInt(asset.Balance))
+		}
+	}
+	for i := 0; i < len(afterCexAssets); i++ {
+		witness.NextCexAssets[i] = afterCexAssets[i]
 	}
 	for i := 0; i < len(witness.UserInstructions); i++ {
 		witness.UserInstructions[i].PreSMTRoot = batchWitness.CreateUserOps[i].BeforeAccountTreeRoot
 		witness.UserInstructions[i].NextSMTRoot = batchWitness.CreateUserOps[i].AfterAccountTreeRoot
-		witness.UserInstructions[i].Assets = make([]Variable, len(batchWitness.CreateUserOps[i].Assets))
+		witness.UserInstructions[i].Assets = make([]UserAssetInfo, len(batchWitness.CreateUserOps[i].Assets))
 		witness.UserInstructions[i].TotalEquity = batchWitness.CreateUserOps[i].TotalEquity
 		witness.UserInstructions[i].TotalDebt = batchWitness.CreateUserOps[i].TotalDebt
 
 		for j := 0; j < len(batchWitness.CreateUserOps[i].Assets); j++ {
-			var userAsset Variable
-			userAsset = batchWitness.CreateUserOps[i].Assets[j].Balance
-			witness.UserInstructions[i].Assets[j] = userAsset
+			witness.UserInstructions[i].Assets[j].AssetIndex = batchWitness.CreateUserOps[i].Assets[j].Index
+			witness.UserInstructions[i].Assets[j].Balance = batchWitness.CreateUserOps[i].Assets[j].Balance
 		}
 		witness.UserInstructions[i].AccountIdHash = batchWitness.CreateUserOps[i].AccountIdHash
 		witness.UserInstructions[i].AccountIndex = batchWitness.CreateUserOps[i].AccountIndex
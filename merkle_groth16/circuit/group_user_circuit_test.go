@@ -0,0 +1,547 @@
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/poseidon"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std"
+	"github.com/consensys/gnark/test"
+)
+
+const (
+	testAssetCounts           = 4 // the user asset commitment hashes at least 2 packed elements
+	testBatchCounts           = 2
+	testSparseAssetCounts     = 10
+	testSparseUserAssetCounts = 4
+)
+
+// 1, 3 and 0.5 usd per balance unit, repeated for the other assets
+var testAssetPrices = []uint64{100000000, 300000000, 50000000}
+
+func testAssetPrice(index int) uint64 {
+	return testAssetPrices[index%len(testAssetPrices)]
+}
+
+// TotalEquity and TotalDebt are computed from Assets and testAssetPrices when both are 0.
+// Assets has a balance for every asset, Slots replaces the slots laid out from it.
+type testAccount struct {
+	AccountIndex uint32
+	TotalEquity  uint64
+	TotalDebt    uint64
+	Assets       []int64
+	Slots        []utils.AccountAsset
+}
+
+// computeTestAssetsCommitment hashes values as they are. They are big.Int so that
+// overflowed totals can be committed.
+func computeTestAssetsCommitment(values []*big.Int) []byte {
+	hasher := poseidon.NewPoseidon()
+	for i := 0; i < len(values); i++ {
+		hasher.Write(values[i].Bytes())
+	}
+	return hasher.Sum(nil)
+}
+
+// computeTestCexAssetsCommitment mirrors utils.ComputeCexAssetsCommitment with testAssetPrices.
+func computeTestCexAssetsCommitment(balances []*big.Int, totalEquity uint64, totalDebt uint64) []byte {
+	values := make([]*big.Int, len(balances), len(balances)+2)
+	for i := 0; i < len(balances); i++ {
+		values[i] = new(big.Int).Add(balances[i], new(big.Int).Lsh(big.NewInt(1), 63))
+		values[i].Lsh(values[i], 64)
+		values[i].Add(values[i], new(big.Int).SetUint64(testAssetPrice(i)))
+	}
+	values = append(values, new(big.Int).SetUint64(totalEquity), new(big.Int).SetUint64(totalDebt))
+	return computeTestAssetsCommitment(values)
+}
+
+// newTestBatchWitness builds a batch witness for the dense circuit the same way the
+// witness service does, but for len(beforeCexAssets) assets and len(accounts) users.
+func newTestBatchWitness(t testing.TB, beforeCexAssets []int64, accounts []testAccount) *utils.BatchCreateUserWitness {
+	return newTestSparseBatchWitness(t, len(beforeCexAssets), beforeCexAssets, accounts)
+}
+
+// newTestSparseBatchWitness is newTestBatchWitness with userAssetCounts slots per user.
+func newTestSparseBatchWitness(t testing.TB, userAssetCounts int, beforeCexAssets []int64, accounts []testAccount) *utils.BatchCreateUserWitness {
+	accountTree, err := utils.NewAccountTree("memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batchWitness := &utils.BatchCreateUserWitness{
+		BeforeAccountTreeRoot: accountTree.Root(),
+		BeforeCexAssets:       make([]utils.CexAssetInfo, len(beforeCexAssets)),
+		CreateUserOps:         make([]utils.CreateUserOperation, len(accounts)),
+	}
+	cexAssets := make([]*big.Int, len(beforeCexAssets))
+	for i := 0; i < len(beforeCexAssets); i++ {
+		batchWitness.BeforeCexAssets[i].TotalBalance = beforeCexAssets[i]
+		batchWitness.BeforeCexAssets[i].BasePrice = testAssetPrice(i)
+		batchWitness.BeforeCexAssets[i].Index = uint32(i)
+		cexAssets[i] = big.NewInt(beforeCexAssets[i])
+	}
+	batchWitness.BeforeCEXAssetsCommitment = computeTestCexAssetsCommitment(cexAssets, 0, 0)
+
+	for i := 0; i < len(accounts); i++ {
+		op := &batchWitness.CreateUserOps[i]
+		op.BeforeAccountTreeRoot = accountTree.Root()
+		proof, err := accountTree.GetProof(uint64(accounts[i].AccountIndex))
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(op.AccountProof[:], proof)
+
+		op.Assets = accounts[i].Slots
+		if op.Assets == nil {
+			assets := make([]utils.AccountAsset, len(accounts[i].Assets))
+			for j := 0; j < len(accounts[i].Assets); j++ {
+				assets[j] = utils.AccountAsset{Index: uint16(j), Balance: accounts[i].Assets[j]}
+			}
+			op.Assets = utils.PaddingAccountAssets(assets, userAssetCounts)
+		}
+		for j := 0; j < len(op.Assets); j++ {
+			index := op.Assets[j].Index
+			cexAssets[index].Add(cexAssets[index], big.NewInt(op.Assets[j].Balance))
+		}
+		op.AccountIndex = accounts[i].AccountIndex
+		op.AccountIdHash = new(fr.Element).SetBytes(utils.HashBytesForUID(strconv.Itoa(int(op.AccountIndex)))).Marshal()
+		op.TotalEquity = accounts[i].TotalEquity
+		op.TotalDebt = accounts[i].TotalDebt
+		if op.TotalEquity == 0 && op.TotalDebt == 0 {
+			equity, debt := utils.ComputeAccountEquityAndDebt(op.Assets, batchWitness.BeforeCexAssets)
+			op.TotalEquity = equity.Uint64()
+			op.TotalDebt = debt.Uint64()
+		}
+		hasher := poseidon.NewPoseidon()
+		accountHash := poseidon.PoseidonBytes(op.AccountIdHash,
+			new(big.Int).SetUint64(op.TotalEquity).Bytes(),
+			new(big.Int).SetUint64(op.TotalDebt).Bytes(),
+			utils.ComputeUserAssetsCommitment(&hasher, op.Assets))
+		err = accountTree.Set(uint64(op.AccountIndex), accountHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		op.AfterAccountTreeRoot = accountTree.Root()
+
+		batchWitness.TotalCexAssets.AfterCEXTotalEquity += op.TotalEquity
+		batchWitness.TotalCexAssets.AfterCEXTotalDebt += op.TotalDebt
+	}
+	batchWitness.AfterAccountTreeRoot = accountTree.Root()
+	batchWitness.AfterCEXAssetsCommitment = computeTestCexAssetsCommitment(cexAssets,
+		batchWitness.TotalCexAssets.AfterCEXTotalEquity, batchWitness.TotalCexAssets.AfterCEXTotalDebt)
+	updateTestBatchCommitment(batchWitness)
+	return batchWitness
+}
+
+func updateTestBatchCommitment(batchWitness *utils.BatchCreateUserWitness) {
+	batchWitness.BatchCommitment = poseidon.PoseidonBytes(
+		batchWitness.BeforeAccountTreeRoot,
+		batchWitness.AfterAccountTreeRoot,
+		batchWitness.BeforeCEXAssetsCommitment,
+		batchWitness.AfterCEXAssetsCommitment)
+}
+
+func newTestCircuitWitness(t testing.TB, batchWitness *utils.BatchCreateUserWitness) *GroupUserCircuit {
+	witness, err := SetBatchCreateUserCircuitWitness(batchWitness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return witness
+}
+
+func testOptions() []test.TestingOption {
+	return []test.TestingOption{test.WithCurves(ecc.BN254), test.WithBackends(backend.GROTH16)}
+}
+
+type absCircuit struct {
+	Value    Variable
+	AbsValue Variable
+}
+
+func (c absCircuit) Define(api API) error {
+	api.AssertIsEqual(Abs(api, c.Value), c.AbsValue)
+	return nil
+}
+
+func TestAbsRange(t *testing.T) {
+	assert := test.NewAssert(t)
+	maxInt64 := new(big.Int).SetInt64(9223372036854775807)
+	minInt64 := new(big.Int).SetInt64(-9223372036854775808)
+
+	valid := [][2]*big.Int{
+		{big.NewInt(0), big.NewInt(0)},
+		{big.NewInt(-5), big.NewInt(5)},
+		{maxInt64, maxInt64},
+		{minInt64, new(big.Int).Neg(minInt64)},
+	}
+	for _, v := range valid {
+		assert.SolvingSucceeded(&absCircuit{}, &absCircuit{Value: v[0], AbsValue: v[1]}, testOptions()...)
+	}
+
+	tooBig := new(big.Int).Add(maxInt64, big.NewInt(1))
+	tooSmall := new(big.Int).Sub(minInt64, big.NewInt(1))
+	invalid := [][2]*big.Int{
+		{tooBig, tooBig},
+		{tooSmall, new(big.Int).Neg(tooSmall)},
+	}
+	for _, v := range invalid {
+		assert.SolvingFailed(&absCircuit{}, &absCircuit{Value: v[0], AbsValue: v[1]}, testOptions()...)
+	}
+}
+
+func TestCexAssetsOverflow(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewBatchCreateUserCircuit(testAssetCounts, testAssetCounts, testBatchCounts)
+
+	half := int64(1) << 62
+	valid := newTestBatchWitness(t, []int64{0, 0, 0, 0}, []testAccount{
+		{AccountIndex: 0, Assets: []int64{half - 1, -3, 0, 0}},
+		{AccountIndex: 1, Assets: []int64{half, 0, -half, 0}},
+	})
+	assert.SolvingSucceeded(circuit, newTestCircuitWitness(t, valid), testOptions()...)
+
+	// every user asset fits in int64 but the cex total for asset 0 reaches 2^63
+	overflow := newTestBatchWitness(t, []int64{0, 0, 0, 0}, []testAccount{
+		{AccountIndex: 0, Assets: []int64{half, 0, 0, 0}},
+		{AccountIndex: 1, Assets: []int64{half, 0, 0, 0}},
+	})
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, overflow), testOptions()...)
+
+	// same for a negative total below -2^63, starting from a non-empty cex state
+	underflow := newTestBatchWitness(t, []int64{0, 0, -half, 0}, []testAccount{
+		{AccountIndex: 0, Assets: []int64{0, half / 4, -half, 0}},
+		{AccountIndex: 1, Assets: []int64{0, 0, -1, 0}},
+	})
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, underflow), testOptions()...)
+}
+
+func newValidTestAccounts() []testAccount {
+	return []testAccount{
+		{AccountIndex: 0, Assets: []int64{32, 0, -7, 0}},
+		{AccountIndex: 1, Assets: []int64{0, 123812, 0, 0}},
+	}
+}
+
+func TestGroupUserCircuitValid(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewBatchCreateUserCircuit(testAssetCounts, testAssetCounts, testBatchCounts)
+
+	batchWitness := newTestBatchWitness(t, []int64{0, 0, 0, 0}, newValidTestAccounts())
+	assert.SolvingSucceeded(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+
+	// a batch that continues from non-empty cex assets
+	batchWitness = newTestBatchWitness(t, []int64{163, 5, -9, 0}, newValidTestAccounts())
+	assert.SolvingSucceeded(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+
+	// accounts don't need to be inserted in index order
+	accounts := newValidTestAccounts()
+	accounts[0].AccountIndex, accounts[1].AccountIndex = 7, 3
+	batchWitness = newTestBatchWitness(t, []int64{0, 0, 0, 0}, accounts)
+	assert.SolvingSucceeded(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+}
+
+func TestGroupUserCircuitWrongAccountIndex(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewBatchCreateUserCircuit(testAssetCounts, testAssetCounts, testBatchCounts)
+	batchWitness := newTestBatchWitness(t, []int64{0, 0, 0, 0}, newValidTestAccounts())
+
+	// the merkle path was generated for index 0
+	witness := newTestCircuitWitness(t, batchWitness)
+	witness.UserInstructions[0].AccountIndex = 2
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	// index doesn't fit in AccountTreeDepth bits
+	witness = newTestCircuitWitness(t, batchWitness)
+	witness.UserInstructions[0].AccountIndex = uint64(1) << utils.AccountTreeDepth
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+}
+
+func TestGroupUserCircuitCommitmentMismatch(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewBatchCreateUserCircuit(testAssetCounts, testAssetCounts, testBatchCounts)
+	batchWitness := newTestBatchWitness(t, []int64{0, 0, 0, 0}, newValidTestAccounts())
+
+	witness := newTestCircuitWitness(t, batchWitness)
+	witness.GroupCommitment = 1
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	// user assets don't match the committed leaf
+	witness = newTestCircuitWitness(t, batchWitness)
+	witness.UserInstructions[1].Assets[1].Balance = 123811
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	// cex assets don't match the committed cex state, with a consistent group commitment
+	modified := newTestBatchWitness(t, []int64{0, 0, 0, 0}, newValidTestAccounts())
+	modified.BeforeCexAssets[0].TotalBalance = 1
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, modified), testOptions()...)
+
+	modified = newTestBatchWitness(t, []int64{0, 0, 0, 0}, newValidTestAccounts())
+	modified.AfterCEXAssetsCommitment = batchWitness.BeforeCEXAssetsCommitment
+	updateTestBatchCommitment(modified)
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, modified), testOptions()...)
+
+	// cex asset prices don't match the committed prices
+	modified = newTestBatchWitness(t, []int64{0, 0, 0, 0}, newValidTestAccounts())
+	witness = newTestCircuitWitness(t, modified)
+	witness.PreCexAssets[1].BasePrice = testAssetPrices[1] + 1
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	// equity total doesn't match the sum of user equities
+	modified = newTestBatchWitness(t, []int64{0, 0, 0, 0}, newValidTestAccounts())
+	modified.TotalCexAssets.AfterCEXTotalEquity += 1
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, modified), testOptions()...)
+}
+
+func TestGroupUserCircuitDebtGreaterThanEquity(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewBatchCreateUserCircuit(testAssetCounts, testAssetCounts, testBatchCounts)
+
+	accounts := newValidTestAccounts()
+	accounts[0].Assets = []int64{1, 0, -3, 0}
+	batchWitness := newTestBatchWitness(t, []int64{0, 0, 0, 0}, accounts)
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+}
+
+func TestGroupUserCircuitPriceWeightedTotals(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewBatchCreateUserCircuit(testAssetCounts, testAssetCounts, testBatchCounts)
+
+	// equity is 32 + 0, debt is 7 * 0.5 rounded up
+	accounts := newValidTestAccounts()
+	accounts[0].Assets = []int64{32, 0, -7, 0}
+	accounts[0].TotalEquity, accounts[0].TotalDebt = 32, 4
+	batchWitness := newTestBatchWitness(t, []int64{0, 0, 0, 0}, accounts)
+	assert.SolvingSucceeded(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+
+	// understated debt, with a leaf that commits to it
+	accounts[0].TotalEquity, accounts[0].TotalDebt = 32, 3
+	batchWitness = newTestBatchWitness(t, []int64{0, 0, 0, 0}, accounts)
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+
+	// overstated equity
+	accounts[0].TotalEquity, accounts[0].TotalDebt = 33, 4
+	batchWitness = newTestBatchWitness(t, []int64{0, 0, 0, 0}, accounts)
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+}
+
+func TestGroupUserCircuitNonEmptyPreLeaf(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewBatchCreateUserCircuit(testAssetCounts, testAssetCounts, testBatchCounts)
+
+	// the second user overwrites the leaf created by the first one
+	accounts := newValidTestAccounts()
+	accounts[1].AccountIndex = accounts[0].AccountIndex
+	batchWitness := newTestBatchWitness(t, []int64{0, 0, 0, 0}, accounts)
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+}
+
+func TestGroupUserCircuitBrokenRootChain(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewBatchCreateUserCircuit(testAssetCounts, testAssetCounts, testBatchCounts)
+	accounts := newValidTestAccounts()
+
+	// the second op is valid on its own but starts from the empty tree instead of
+	// the root left by the first op
+	batchWitness := newTestBatchWitness(t, []int64{0, 0, 0, 0}, accounts)
+	detached := newTestBatchWitness(t, []int64{0, 0, 0, 0}, accounts[1:])
+	batchWitness.CreateUserOps[1] = detached.CreateUserOps[0]
+	batchWitness.AfterAccountTreeRoot = detached.AfterAccountTreeRoot
+	updateTestBatchCommitment(batchWitness)
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+
+	// the batch doesn't start from the root of the first op
+	batchWitness = newTestBatchWitness(t, []int64{0, 0, 0, 0}, accounts)
+	batchWitness.BeforeAccountTreeRoot = batchWitness.CreateUserOps[1].BeforeAccountTreeRoot
+	updateTestBatchCommitment(batchWitness)
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+
+	// the batch doesn't end at the root of the last op
+	batchWitness = newTestBatchWitness(t, []int64{0, 0, 0, 0}, accounts)
+	batchWitness.AfterAccountTreeRoot = batchWitness.CreateUserOps[0].AfterAccountTreeRoot
+	updateTestBatchCommitment(batchWitness)
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+}
+
+type userAssetIndexesCircuit struct {
+	Indexes  [testSparseUserAssetCounts]Variable
+	Prices   [testSparseAssetCounts]Variable
+	Selected [testSparseUserAssetCounts]Variable
+}
+
+func (c userAssetIndexesCircuit) Define(api API) error {
+	assets := make([]UserAssetInfo, len(c.Indexes))
+	for i := 0; i < len(assets); i++ {
+		assets[i] = UserAssetInfo{AssetIndex: c.Indexes[i], Balance: 0}
+	}
+	indexBits := CheckUserAssetIndexes(api, assets, len(c.Prices))
+	for i := 0; i < len(assets); i++ {
+		api.AssertIsEqual(SelectByIndexBits(api, c.Prices[:], indexBits[i]), c.Selected[i])
+	}
+	return nil
+}
+
+func TestUserAssetIndexes(t *testing.T) {
+	assert := test.NewAssert(t)
+	newWitness := func(indexes [testSparseUserAssetCounts]int) *userAssetIndexesCircuit {
+		var witness userAssetIndexesCircuit
+		for i := 0; i < len(witness.Prices); i++ {
+			witness.Prices[i] = 100 + i
+		}
+		for i := 0; i < len(indexes); i++ {
+			witness.Indexes[i] = indexes[i]
+			witness.Selected[i] = 100 + indexes[i]
+		}
+		return &witness
+	}
+
+	valid := [][testSparseUserAssetCounts]int{
+		{0, 1, 2, 3},
+		{0, 4, 8, 9},
+		{6, 7, 8, 9},
+	}
+	for _, indexes := range valid {
+		assert.SolvingSucceeded(&userAssetIndexesCircuit{}, newWitness(indexes), testOptions()...)
+	}
+
+	invalid := [][testSparseUserAssetCounts]int{
+		{0, 2, 2, 3},
+		{0, 3, 2, 4},
+		{0, 1, 2, testSparseAssetCounts},
+		{0, 1, 2, 255},
+	}
+	for _, indexes := range invalid {
+		assert.SolvingFailed(&userAssetIndexesCircuit{}, newWitness(indexes), testOptions()...)
+	}
+}
+
+func newValidTestSparseAccounts() []testAccount {
+	return []testAccount{
+		{AccountIndex: 0, Assets: []int64{0, 0, 32, 0, 0, 0, 0, 0, 0, -7}},
+		{AccountIndex: 1, Assets: []int64{0, 123812, 0, 0, 0, 15, 0, 2, 0, 0}},
+	}
+}
+
+func TestGroupUserCircuitSparse(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewBatchCreateUserCircuit(testSparseAssetCounts, testSparseUserAssetCounts, testBatchCounts)
+	beforeCexAssets := []int64{163, 5, -9, 0, 0, 0, 0, 0, 0, 11}
+
+	batchWitness := newTestSparseBatchWitness(t, testSparseUserAssetCounts, beforeCexAssets, newValidTestSparseAccounts())
+	assert.SolvingSucceeded(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+
+	// the price of the last asset is selected for the slot of index 9
+	accounts := newValidTestSparseAccounts()
+	accounts[0].TotalEquity, accounts[0].TotalDebt = 96, 4
+	batchWitness = newTestSparseBatchWitness(t, testSparseUserAssetCounts, beforeCexAssets, accounts)
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+
+	// slots with the same index, committed in the leaf
+	accounts = newValidTestSparseAccounts()
+	accounts[0].Slots = []utils.AccountAsset{{Index: 0}, {Index: 2, Balance: 16}, {Index: 2, Balance: 16}, {Index: 9, Balance: -7}}
+	batchWitness = newTestSparseBatchWitness(t, testSparseUserAssetCounts, beforeCexAssets, accounts)
+	assert.SolvingFailed(circuit, newTestCircuitWitness(t, batchWitness), testOptions()...)
+
+	// cex balances which are committed but moved between assets of the same price
+	batchWitness = newTestSparseBatchWitness(t, testSparseUserAssetCounts, beforeCexAssets, newValidTestSparseAccounts())
+	witness := newTestCircuitWitness(t, batchWitness)
+	nextCexAssets := make([]*big.Int, testSparseAssetCounts)
+	for i := 0; i < testSparseAssetCounts; i++ {
+		nextCexAssets[i] = witness.NextCexAssets[i].(*big.Int)
+	}
+	nextCexAssets[2].Sub(nextCexAssets[2], big.NewInt(1))
+	nextCexAssets[5].Add(nextCexAssets[5], big.NewInt(1))
+	batchWitness.AfterCEXAssetsCommitment = computeTestCexAssetsCommitment(nextCexAssets,
+		batchWitness.TotalCexAssets.AfterCEXTotalEquity, batchWitness.TotalCexAssets.AfterCEXTotalDebt)
+	updateTestBatchCommitment(batchWitness)
+	witness.GroupCommitment = batchWitness.BatchCommitment
+	witness.NextCEXCommitment = batchWitness.AfterCEXAssetsCommitment
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+}
+
+// BenchmarkGroupUserCircuit compiles the dense and the sparse circuit for utils.AssetCounts
+// assets, reports their constraints per user and per batch and times the proof of a batch
+// of 2 users with groth16.ProveRoll and lazy keys, as the prover does (groth16.Prove of this
+// gnark fork doesn't support the lazy poseidon constraints). The dense circuit,
+// user_assets_174, is the baseline of the sparse one, see the table in the README:
+//
+//	go test -run '^$' -bench GroupUserCircuit -benchtime 3x -timeout 1h ./merkle_groth16/circuit
+func BenchmarkGroupUserCircuit(b *testing.B) {
+	std.RegisterHints()
+	for _, userAssetCounts := range utils.UserAssetCountsTiers {
+		b.Run(fmt.Sprintf("user_assets_%d", userAssetCounts), func(b *testing.B) {
+			var constraints [testBatchCounts + 1]int
+			var ccs frontend.CompiledConstraintSystem
+			for batchCounts := 1; batchCounts <= testBatchCounts; batchCounts++ {
+				var err error
+				ccs, err = frontend.Compile(ecc.BN254, r1cs.NewBuilder,
+					NewBatchCreateUserCircuit(utils.AssetCounts, uint32(userAssetCounts), uint32(batchCounts)))
+				if err != nil {
+					b.Fatal(err)
+				}
+				constraints[batchCounts] = ccs.GetNbConstraints()
+			}
+			zkKeyName := filepath.Join(b.TempDir(), "zkpor")
+			err := groth16.SetupLazyWithDump(ccs, zkKeyName)
+			if err != nil {
+				b.Fatal(err)
+			}
+			pk, err := groth16.ReadSegmentProveKey(zkKeyName)
+			if err != nil {
+				b.Fatal(err)
+			}
+			vk := groth16.NewVerifyingKey(ecc.BN254)
+			vkFile, err := os.Open(zkKeyName + ".vk.save")
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, err = vk.ReadFrom(vkFile)
+			vkFile.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			accounts := []testAccount{
+				{AccountIndex: 0, Assets: make([]int64, utils.AssetCounts)},
+				{AccountIndex: 1, Assets: make([]int64, utils.AssetCounts)},
+			}
+			accounts[0].Assets[0], accounts[0].Assets[5], accounts[0].Assets[173] = 5, 7, -1
+			accounts[1].Assets[2] = 3
+			batchWitness := newTestSparseBatchWitness(b, userAssetCounts, make([]int64, utils.AssetCounts), accounts)
+			circuitWitness := newTestCircuitWitness(b, batchWitness)
+			witness, err := frontend.NewWitness(circuitWitness, ecc.BN254)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			var proof groth16.Proof
+			for i := 0; i < b.N; i++ {
+				proof, err = groth16.ProveRoll(ccs, pk[0], pk[1], witness, zkKeyName)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			publicWitness, err := frontend.NewWitness(circuitWitness, ecc.BN254, frontend.PublicOnly())
+			if err != nil {
+				b.Fatal(err)
+			}
+			err = groth16.Verify(proof, vk, publicWitness)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(constraints[2]-constraints[1]), "constraints/user")
+			b.ReportMetric(float64(2*constraints[1]-constraints[2]), "constraints/batch")
+		})
+	}
+}
@@ -13,6 +13,7 @@ type (
 
 type CexAssetInfo struct {
 	TotalBalance Variable
+	BasePrice    Variable
 }
 
 type CexAssetsInfo struct {
@@ -22,10 +23,22 @@ type CexAssetsInfo struct {
 	NextCEXTotalDebt   Variable
 }
 
+// UserAssetInfo is an asset slot of a user, see utils.PaddingAccountAssets
+type UserAssetInfo struct {
+	AssetIndex Variable
+	Balance    Variable
+}
+
+// UserAssetClaim is a utils.UserAssetClaim of the user inclusion circuit
+type UserAssetClaim struct {
+	AssetIndex Variable
+	MinBalance Variable
+}
+
 type UserInstruction struct {
 	PreSMTRoot    Variable
 	NextSMTRoot   Variable
-	Assets        []Variable
+	Assets        []UserAssetInfo
 	TotalEquity   Variable
 	TotalDebt     Variable
 	AccountIndex  Variable
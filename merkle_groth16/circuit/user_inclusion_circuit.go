@@ -0,0 +1,107 @@
+package circuit
+
+import (
+	"fmt"
+	"math/big"
+	"merkleverifytool/merkle_groth16/src/utils"
+
+	"github.com/consensys/gnark/std/hash/poseidon"
+)
+
+// UserInclusionCircuit proves that the leaf of a user is in the account tree with root
+// AccountTreeRoot and that the balances of the claimed assets are at least their
+// MinBalance. The other assets, the totals and the account index stay private.
+type UserInclusionCircuit struct {
+	AccountTreeRoot Variable         `gnark:",public"`
+	AccountIdHash   Variable         `gnark:",public"`
+	Claims          []UserAssetClaim `gnark:",public"`
+	AccountIndex    Variable
+	TotalEquity     Variable
+	TotalDebt       Variable
+	Assets          []UserAssetInfo
+	AccountProof    [utils.AccountTreeDepth]Variable
+}
+
+// NewUserInclusionCircuit returns the circuit for users with userAssetCounts asset slots,
+// see utils.UserAssetCountsTiers.
+func NewUserInclusionCircuit(userAssetCounts uint32, claimCounts uint32) *UserInclusionCircuit {
+	var circuit UserInclusionCircuit
+	circuit.AccountTreeRoot = 0
+	circuit.AccountIdHash = 0
+	circuit.AccountIndex = 0
+	circuit.TotalEquity = 0
+	circuit.TotalDebt = 0
+	circuit.Claims = make([]UserAssetClaim, claimCounts)
+	for i := uint32(0); i < claimCounts; i++ {
+		circuit.Claims[i] = UserAssetClaim{AssetIndex: 0, MinBalance: 0}
+	}
+	circuit.Assets = make([]UserAssetInfo, userAssetCounts)
+	for i := uint32(0); i < userAssetCounts; i++ {
+		circuit.Assets[i] = UserAssetInfo{AssetIndex: 0, Balance: 0}
+	}
+	for i := 0; i < utils.AccountTreeDepth; i++ {
+		circuit.AccountProof[i] = 0
+	}
+	return &circuit
+}
+
+func (b UserInclusionCircuit) Define(api API) error {
+	// the slots are range checked like in the batch circuits, otherwise other slots could
+	// pack into the same commitment
+	CheckUserAssetIndexes(api, b.Assets, utils.AssetCounts)
+	userAssetsCommitment := ComputeUserAssetsCommitment(api, b.Assets)
+	accountHash := poseidon.Poseidon(api, b.AccountIdHash, b.TotalEquity, b.TotalDebt, userAssetsCommitment)
+	accountIndexHelper := AccountIdToMerkleHelper(api, b.AccountIndex)
+	VerifyMerkleProof(api, b.AccountTreeRoot, accountHash, b.AccountProof[:], accountIndexHelper)
+
+	// the slot indexes are distinct, so the balance of an asset without a slot is 0
+	for i := 0; i < len(b.Claims); i++ {
+		balance := Variable(0)
+		for j := 0; j < len(b.Assets); j++ {
+			isClaimed := api.IsZero(api.Sub(b.Assets[j].AssetIndex, b.Claims[i].AssetIndex))
+			balance = api.Add(balance, api.Mul(isClaimed, b.Assets[j].Balance))
+		}
+		// both are int64, so balance >= MinBalance iff their difference is in [0, 2^64)
+		CheckValueInRange(api, api.Sub(balance, b.Claims[i].MinBalance))
+	}
+	return nil
+}
+
+// SetUserInclusionCircuitWitness builds the witness from the leaf data and the merkle proof
+// of a user proof.
+func SetUserInclusionCircuitWitness(accountTreeRoot []byte, accountIndex uint32, accountIdHash []byte,
+	totalEquity *big.Int, totalDebt *big.Int, assets []utils.AccountAsset, accountProof [][]byte,
+	claims []utils.UserAssetClaim) (witness *UserInclusionCircuit, err error) {
+	if len(accountProof) != utils.AccountTreeDepth {
+		return nil, fmt.Errorf("the account proof has %d hashes instead of %d", len(accountProof), utils.AccountTreeDepth)
+	}
+	if len(claims) != utils.UserInclusionClaimCounts {
+		return nil, fmt.Errorf("%d claims instead of %d", len(claims), utils.UserInclusionClaimCounts)
+	}
+	witness = NewVerifyUserInclusionCircuit(accountTreeRoot, accountIdHash, claims)
+	witness.AccountIndex = accountIndex
+	witness.TotalEquity = totalEquity
+	witness.TotalDebt = totalDebt
+	witness.Assets = make([]UserAssetInfo, len(assets))
+	for i := 0; i < len(assets); i++ {
+		witness.Assets[i].AssetIndex = assets[i].Index
+		witness.Assets[i].Balance = assets[i].Balance
+	}
+	for i := 0; i < utils.AccountTreeDepth; i++ {
+		witness.AccountProof[i] = accountProof[i]
+	}
+	return witness, nil
+}
+
+// NewVerifyUserInclusionCircuit sets the public inputs of the user inclusion circuit.
+func NewVerifyUserInclusionCircuit(accountTreeRoot []byte, accountIdHash []byte, claims []utils.UserAssetClaim) *UserInclusionCircuit {
+	var v UserInclusionCircuit
+	v.AccountTreeRoot = accountTreeRoot
+	v.AccountIdHash = accountIdHash
+	v.Claims = make([]UserAssetClaim, len(claims))
+	for i := 0; i < len(claims); i++ {
+		v.Claims[i].AssetIndex = claims[i].Index
+		v.Claims[i].MinBalance = claims[i].MinBalance
+	}
+	return &v
+}
@@ -0,0 +1,90 @@
+package circuit
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+// newTestUserInclusionWitness proves the last user of batchWitness against its after root,
+// the siblings of the last inserted leaf don't change.
+func newTestUserInclusionWitness(t *testing.T, batchWitness *utils.BatchCreateUserWitness, claims []utils.UserAssetClaim) *UserInclusionCircuit {
+	op := batchWitness.CreateUserOps[len(batchWitness.CreateUserOps)-1]
+	witness, err := SetUserInclusionCircuitWitness(batchWitness.AfterAccountTreeRoot, op.AccountIndex, op.AccountIdHash,
+		new(big.Int).SetUint64(op.TotalEquity), new(big.Int).SetUint64(op.TotalDebt), op.Assets, op.AccountProof[:],
+		utils.PaddingUserAssetClaims(claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return witness
+}
+
+func TestUserInclusionCircuit(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewUserInclusionCircuit(testAssetCounts, utils.UserInclusionClaimCounts)
+	batchWitness := newTestBatchWitness(t, []int64{0, 0, 0, 0}, newValidTestAccounts())
+
+	witness := newTestUserInclusionWitness(t, batchWitness, []utils.UserAssetClaim{{Index: 1, MinBalance: 123812}, {Index: 1, MinBalance: 100}})
+	assert.SolvingSucceeded(circuit, witness, testOptions()...)
+	publicWitness, err := frontend.NewWitness(NewVerifyUserInclusionCircuit(batchWitness.AfterAccountTreeRoot,
+		batchWitness.CreateUserOps[1].AccountIdHash, utils.PaddingUserAssetClaims(nil)), ecc.BN254, frontend.PublicOnly())
+	assert.NoError(err)
+	// root, account id hash and an asset index and balance per claim
+	assert.Equal(2+2*utils.UserInclusionClaimCounts, publicWitness.Schema.NbPublic)
+
+	witness = newTestUserInclusionWitness(t, batchWitness, []utils.UserAssetClaim{{Index: 1, MinBalance: 123813}})
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	witness = newTestUserInclusionWitness(t, batchWitness, []utils.UserAssetClaim{{Index: 0, MinBalance: 1}})
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	// the claims hold only for the committed balances
+	witness = newTestUserInclusionWitness(t, batchWitness, []utils.UserAssetClaim{{Index: 0, MinBalance: 1}})
+	witness.Assets[0].Balance = 1
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	witness = newTestUserInclusionWitness(t, batchWitness, nil)
+	witness.AccountTreeRoot = batchWitness.BeforeAccountTreeRoot
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	witness = newTestUserInclusionWitness(t, batchWitness, nil)
+	witness.AccountIdHash = batchWitness.CreateUserOps[0].AccountIdHash
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+}
+
+func TestUserInclusionCircuitNegativeBalance(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewUserInclusionCircuit(testAssetCounts, utils.UserInclusionClaimCounts)
+	batchWitness := newTestBatchWitness(t, []int64{0, 0, 0, 0}, newValidTestAccounts()[:1])
+
+	witness := newTestUserInclusionWitness(t, batchWitness, []utils.UserAssetClaim{{Index: 2, MinBalance: -7}, {Index: 2, MinBalance: math.MinInt64}})
+	assert.SolvingSucceeded(circuit, witness, testOptions()...)
+
+	witness = newTestUserInclusionWitness(t, batchWitness, []utils.UserAssetClaim{{Index: 2, MinBalance: -6}})
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+}
+
+func TestUserInclusionCircuitSparse(t *testing.T) {
+	assert := test.NewAssert(t)
+	circuit := NewUserInclusionCircuit(testSparseUserAssetCounts, utils.UserInclusionClaimCounts)
+	assets := make([]int64, testSparseAssetCounts)
+	assets[3], assets[9] = 11, -2
+	accounts := []testAccount{{AccountIndex: 5, Assets: assets}}
+	batchWitness := newTestSparseBatchWitness(t, testSparseUserAssetCounts, make([]int64, testSparseAssetCounts), accounts)
+
+	witness := newTestUserInclusionWitness(t, batchWitness, []utils.UserAssetClaim{{Index: 3, MinBalance: 11}, {Index: 7, MinBalance: 0}})
+	assert.SolvingSucceeded(circuit, witness, testOptions()...)
+
+	// asset 7 has no slot, so its balance is 0
+	witness = newTestUserInclusionWitness(t, batchWitness, []utils.UserAssetClaim{{Index: 7, MinBalance: 1}})
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+
+	witness = newTestUserInclusionWitness(t, batchWitness, []utils.UserAssetClaim{{Index: 9, MinBalance: -1}})
+	assert.SolvingFailed(circuit, witness, testOptions()...)
+}
@@ -40,22 +40,181 @@ func CheckValueInRange(api API, value Variable) {
 	api.ToBinary(value, 64)
 }
 
+// Abs constrains i to the signed 64-bit range [-2^63, 2^63-1] and returns |i|.
+// i + 2^63 is decomposed into 64 bits, so any value outside the range (including
+// values that wrapped around the field modulus) makes the decomposition unsatisfiable.
 func Abs(api frontend.API, i frontend.Variable) frontend.Variable {
-	// _v + 2 ** 66 - bound
-	// _v should be less than 2 ** 66
-	// bound should be less than 2 ** 66
-	temp := api.Add(i, new(big.Int).Exp(new(big.Int).SetUint64(2), new(big.Int).SetInt64(int64(68-2)), nil))
-	bitsTemp := api.ToBinary(temp, 68)
-	cmResult := bitsTemp[68-2]
-	return api.Select(cmResult, i, api.Neg(i))
+	abs, _ := AbsWithSign(api, i)
+	return abs
+}
+
+// AbsWithSign is Abs which also returns 1 if i is non-negative and 0 otherwise.
+// The most significant bit of i + 2^63 is set iff i is non-negative.
+func AbsWithSign(api frontend.API, i frontend.Variable) (abs frontend.Variable, isNonNegative frontend.Variable) {
+	temp := api.Add(i, new(big.Int).Lsh(big.NewInt(1), SignedValueBits-1))
+	bitsTemp := api.ToBinary(temp, SignedValueBits)
+	isNonNegative = bitsTemp[SignedValueBits-1]
+	return api.Select(isNonNegative, i, api.Neg(i)), isNonNegative
+}
+
+// CheckUserAssetIndexes constrains the AssetIndex of the asset slots of a user. The dense
+// layout has one slot per asset in index order. Otherwise the indexes must be strictly
+// increasing and less than assetCounts, and their bits are returned for SelectByIndexBits.
+func CheckUserAssetIndexes(api API, assets []UserAssetInfo, assetCounts int) [][]Variable {
+	if len(assets) == assetCounts {
+		for i := 0; i < len(assets); i++ {
+			api.AssertIsEqual(assets[i].AssetIndex, i)
+		}
+		return nil
+	}
+	indexBits := make([][]Variable, len(assets))
+	for i := 0; i < len(assets); i++ {
+		indexBits[i] = api.ToBinary(assets[i].AssetIndex, utils.UserAssetIndexBits)
+		if i > 0 {
+			api.ToBinary(api.Sub(assets[i].AssetIndex, assets[i-1].AssetIndex, 1), utils.UserAssetIndexBits)
+		}
+	}
+	api.ToBinary(api.Sub(assetCounts-1, assets[len(assets)-1].AssetIndex), utils.UserAssetIndexBits)
+	return indexBits
+}
+
+// SelectByIndexBits returns values[index] for the little-endian bits of index, which must
+// be less than len(values). A node without a sibling can only be reached by a 0 bit, so it
+// is passed up without a select.
+func SelectByIndexBits(api API, values []Variable, bits []Variable) Variable {
+	level := values
+	for i := 0; len(level) > 1; i++ {
+		next := make([]Variable, (len(level)+1)/2)
+		for j := 0; j+1 < len(level); j += 2 {
+			next[j/2] = api.Select(bits[i], level[j+1], level[j])
+		}
+		if len(level)%2 == 1 {
+			next[len(next)-1] = level[len(level)-1]
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// ComputeUserAssetsCommitment hashes the asset slots of a user the same way as
+// utils.ComputeUserAssetsCommitment. Every balance goes through Abs, so it also range
+// checks them, the indexes are checked by CheckUserAssetIndexes.
+func ComputeUserAssetsCommitment(api API, assets []UserAssetInfo) Variable {
+	for i := 0; i < len(assets); i++ {
+		Abs(api, assets[i].Balance)
+	}
+	return hashUserAssets(api, assets)
+}
+
+// ComputeUserAssetsCommitmentAndValue is ComputeUserAssetsCommitment which also returns
+// the price weighted sums of the positive and of the negative balances of assets. indexBits
+// is returned by CheckUserAssetIndexes, the price of a sparse slot is selected by them.
+func ComputeUserAssetsCommitmentAndValue(api API, assets []UserAssetInfo, prices []Variable, indexBits [][]Variable) (commitment Variable, equity Variable, debt Variable) {
+	total := frontend.Variable(0)
+	equity = frontend.Variable(0)
+	for i := 0; i < len(assets); i++ {
+		abs, isNonNegative := AbsWithSign(api, assets[i].Balance)
+		var price Variable
+		if indexBits == nil {
+			price = prices[i]
+		} else {
+			price = SelectByIndexBits(api, prices, indexBits[i])
+		}
+		value := api.Mul(abs, price)
+		total = api.Add(total, value)
+		equity = api.Add(equity, api.Mul(isNonNegative, value))
+	}
+	commitment = hashUserAssets(api, assets)
+	debt = api.Sub(total, equity)
+	return commitment, equity, debt
+}
 
+// every slot is AssetIndex * 2^64 + (Balance + 2^63), which takes utils.UserAssetBits once
+// both are range checked, and utils.UserAssetsPerElement slots are packed into one element
+func hashUserAssets(api API, assets []UserAssetInfo) Variable {
+	packedAssets := make([]Variable, 0, (len(assets)+utils.UserAssetsPerElement-1)/utils.UserAssetsPerElement)
+	for i := 0; i < len(assets); i++ {
+		packed := api.Add(api.Mul(assets[i].AssetIndex, new(big.Int).Lsh(big.NewInt(1), 64)),
+			assets[i].Balance, new(big.Int).Lsh(big.NewInt(1), SignedValueBits-1))
+		shift := (i % utils.UserAssetsPerElement) * utils.UserAssetBits
+		if shift == 0 {
+			packedAssets = append(packedAssets, packed)
+		} else {
+			last := len(packedAssets) - 1
+			packedAssets[last] = api.Add(packedAssets[last], api.Mul(packed, new(big.Int).Lsh(big.NewInt(1), uint(shift))))
+		}
+	}
+	return poseidon.Poseidon(api, packedAssets...)
 }
 
-func ComputeUserAssetsCommitment(api API, assets []Variable) Variable {
-	assets_ := make([]frontend.Variable, len(assets))
+// AssertIsAssetsDelta checks that deltas[j] is the sum of the balances of the sparse slots
+// with AssetIndex j, without selecting a delta for every slot. Both sides are evaluated as
+// polynomials in r:
+//
+//	sum(deltas[j] * r^j) == sum(Balance * r^AssetIndex)
+//
+// The polynomials differ at no more than len(deltas) points unless they are equal, so the
+// check is sound when r is a hash of deltas and of the slots, which are bound by the user
+// asset commitments. Slot indexes are unique per user and balances are int64, so the sums
+// don't wrap around the field modulus.
+func AssertIsAssetsDelta(api API, r Variable, deltas []Variable, assets [][]UserAssetInfo, indexBits [][][]Variable) {
+	expected := frontend.Variable(0)
+	power := frontend.Variable(1)
+	for j := 0; j < len(deltas); j++ {
+		expected = api.Add(expected, api.Mul(deltas[j], power))
+		power = api.Mul(power, r)
+	}
+	// r^(2^k), so r^AssetIndex is the product of the ones selected by the index bits
+	squares := make([]Variable, utils.UserAssetIndexBits)
+	squares[0] = r
+	for k := 1; k < len(squares); k++ {
+		squares[k] = api.Mul(squares[k-1], squares[k-1])
+	}
+	actual := frontend.Variable(0)
 	for i := 0; i < len(assets); i++ {
-		assets_[i] = Abs(api, assets[i])
+		for j := 0; j < len(assets[i]); j++ {
+			power := frontend.Variable(1)
+			for k := 0; k < len(squares); k++ {
+				power = api.Mul(power, api.Select(indexBits[i][j][k], squares[k], 1))
+			}
+			actual = api.Add(actual, api.Mul(assets[i][j].Balance, power))
+		}
+	}
+	api.AssertIsEqual(expected, actual)
+}
+
+// ComputeCexAssetsCommitment hashes (TotalBalance + 2^63) * 2^64 + BasePrice of every cex
+// asset followed by the cex total equity and total debt, so the sign of every balance is
+// committed. It range checks the balances and the prices, the totals are range checked
+// by the caller.
+func ComputeCexAssetsCommitment(api API, balances []Variable, prices []Variable, totalEquity Variable, totalDebt Variable) Variable {
+	assets_ := make([]frontend.Variable, len(balances), len(balances)+2)
+	for i := 0; i < len(balances); i++ {
+		CheckValueInRange(api, prices[i])
+		balance := api.Add(balances[i], new(big.Int).Lsh(big.NewInt(1), SignedValueBits-1))
+		CheckValueInRange(api, balance)
+		assets_[i] = api.Add(api.Mul(balance, new(big.Int).Lsh(big.NewInt(1), 64)), prices[i])
 	}
+	assets_ = append(assets_, totalEquity, totalDebt)
 	commitment := poseidon.Poseidon(api, assets_...)
 	return commitment
 }
+
+// AssertIsFloorDiv checks quotient == floor(dividend / utils.PriceMultiplier).
+// dividend must be far below the field modulus, which holds for price weighted sums.
+func AssertIsFloorDiv(api API, quotient Variable, dividend Variable) {
+	remainder := api.Sub(dividend, api.Mul(quotient, utils.PriceMultiplier))
+	assertIsPriceRemainder(api, remainder)
+}
+
+// AssertIsCeilDiv checks quotient == ceil(dividend / utils.PriceMultiplier).
+func AssertIsCeilDiv(api API, quotient Variable, dividend Variable) {
+	remainder := api.Sub(api.Mul(quotient, utils.PriceMultiplier), dividend)
+	assertIsPriceRemainder(api, remainder)
+}
+
+// remainder must be in [0, utils.PriceMultiplier)
+func assertIsPriceRemainder(api API, remainder Variable) {
+	api.ToBinary(remainder, PriceRemainderBits)
+	api.ToBinary(api.Sub(utils.PriceMultiplier-1, remainder), PriceRemainderBits)
+}
@@ -0,0 +1,112 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxArchiveFileSize bounds the extracted size of a file of an archive
+const maxArchiveFileSize = 1 << 30
+
+// Pack writes the files of the bundle directory dir into the tar.gz archive path.
+func Pack(dir string, path string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		name, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		err = tw.WriteHeader(&tar.Header{
+			Name:    filepath.ToSlash(name),
+			Mode:    0644,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Unpack extracts the regular files of the tar.gz archive path into the directory dir.
+func Unpack(path string, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if !isLocalPath(header.Name) {
+			return fmt.Errorf("archive file %s is outside of the bundle", header.Name)
+		}
+		if header.Size > maxArchiveFileSize {
+			return fmt.Errorf("archive file %s is too large", header.Name)
+		}
+		file := filepath.Join(dir, filepath.FromSlash(header.Name))
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			return err
+		}
+		dst, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(dst, tr, header.Size)
+		dst.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// isLocalPath reports whether the relative path name stays within its directory.
+func isLocalPath(name string) bool {
+	name = filepath.Clean(filepath.FromSlash(name))
+	return !filepath.IsAbs(name) && name != ".." && !strings.HasPrefix(name, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,232 @@
+// Package bundle reads and writes the proof bundles handed to external verifiers: a
+// directory, or a tar.gz archive of it, of the batch proofs in csv or json, the verifying
+// keys and a manifest.json with the circuit profile, the cex asset registry and totals,
+// the final account tree root, the snapshot time and the checksums of the bundle files.
+// The manifest is signed by the exchange in manifest.sig.
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+	verifierConfig "merkleverifytool/merkle_groth16/src/verifier/config"
+
+	"github.com/gocarina/gocsv"
+)
+
+const (
+	// Version 2 added the verifying key files, the final account tree root and the
+	// snapshot time
+	Version      = 2
+	ManifestFile = "manifest.json"
+	KeyDir       = "keys"
+	FormatCsv    = "csv"
+	FormatJson   = "json"
+)
+
+// Proof is a row of the proof table of a bundle, the column names are the csv header and
+// the json keys.
+type Proof struct {
+	BatchNumber        int64    `csv:"BatchNumber" json:"BatchNumber"`
+	ZkProof            string   `csv:"ProofInfo" json:"ProofInfo"`
+	CexAssetCommitment []string `csv:"CexAssetListCommitments" json:"CexAssetListCommitments"`
+	AccountTreeRoots   []string `csv:"AccountTreeRoots" json:"AccountTreeRoots"`
+	BatchCommitment    string   `csv:"BatchCommitment" json:"BatchCommitment"`
+	ZkKeyName          string   `csv:"ZkKeyName" json:"ZkKeyName"` // base name of the key of the batch
+}
+
+// CircuitProfile are the circuit parameters the proofs are built with, a verifier built
+// with other ones can't verify them.
+type CircuitProfile struct {
+	ZkKeyName                     string // base name of the dense circuit key, see utils.GetZkKeyName
+	AssetCounts                   int
+	AccountTreeDepth              int
+	BatchCreateUserOpsCountsTiers []int
+	UserAssetCountsTiers          []int
+}
+
+// CurrentProfile returns the profile of the circuits of this build with zkKeyName.
+func CurrentProfile(zkKeyName string) CircuitProfile {
+	return CircuitProfile{
+		ZkKeyName:                     filepath.Base(zkKeyName),
+		AssetCounts:                   utils.AssetCounts,
+		AccountTreeDepth:              utils.AccountTreeDepth,
+		BatchCreateUserOpsCountsTiers: utils.BatchCreateUserOpsCountsTiers,
+		UserAssetCountsTiers:          utils.UserAssetCountsTiers,
+	}
+}
+
+type Manifest struct {
+	Version         int
+	CreatedAt       time.Time
+	SnapshotTime    time.Time // time of the user balances the proofs are built on
+	ProofFile       string    // proofs.csv or proofs.json
+	ProofCounts     int
+	Profile         CircuitProfile
+	VerifyingKeys   map[string]string // sha256 of the .vk.save file by key base name
+	AccountTreeRoot string            // hex of the account tree root after the last batch
+	CexAssetsInfo   []utils.CexAssetInfo
+	CexTotalEquity  uint64
+	CexTotalDebt    uint64
+	Checksums       map[string]string // sha256 of the bundle files by path in the bundle
+}
+
+// AddVerifyingKey copies the verifying key file of zkKeyName into the keys directory of
+// the bundle in dir and records its hash in manifest.
+func AddVerifyingKey(dir string, manifest *Manifest, zkKeyName string) error {
+	content, err := ioutil.ReadFile(zkKeyName + ".vk.save")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Join(dir, KeyDir), 0755)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(zkKeyName)
+	path := KeyDir + "/" + name + ".vk.save"
+	err = ioutil.WriteFile(filepath.Join(dir, path), content, 0644)
+	if err != nil {
+		return err
+	}
+	if manifest.VerifyingKeys == nil {
+		manifest.VerifyingKeys = make(map[string]string)
+	}
+	if manifest.Checksums == nil {
+		manifest.Checksums = make(map[string]string)
+	}
+	manifest.VerifyingKeys[name] = Sha256Hex(content)
+	manifest.Checksums[path] = manifest.VerifyingKeys[name]
+	return nil
+}
+
+// Write writes proofs in format and the manifest into the directory dir, it fills the
+// version, the proof file and counts and the checksum of the proof file of manifest.
+func Write(dir string, format string, manifest *Manifest, proofs []*Proof) error {
+	var content []byte
+	var err error
+	switch format {
+	case FormatCsv:
+		content, err = gocsv.MarshalBytes(proofs)
+	case FormatJson:
+		content, err = json.MarshalIndent(proofs, "", "  ")
+	default:
+		return fmt.Errorf("unknown bundle format %s, csv or json", format)
+	}
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	if manifest.Checksums == nil {
+		manifest.Checksums = make(map[string]string)
+	}
+	manifest.Version = Version
+	manifest.ProofFile = "proofs." + format
+	manifest.ProofCounts = len(proofs)
+	err = ioutil.WriteFile(filepath.Join(dir, manifest.ProofFile), content, 0644)
+	if err != nil {
+		return err
+	}
+	manifest.Checksums[manifest.ProofFile] = Sha256Hex(content)
+	content, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, ManifestFile), content, 0644)
+}
+
+// Load reads the manifest of the bundle in dir and checks its version, its circuit
+// profile against the one of this build and the checksums of its files.
+func Load(dir string) (*Manifest, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	err = json.Unmarshal(content, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("parse bundle manifest failed: %w", err)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return nil, fmt.Errorf("bundle version %d, up to %d is supported", manifest.Version, Version)
+	}
+	if !reflect.DeepEqual(manifest.Profile, CurrentProfile(manifest.Profile.ZkKeyName)) {
+		return nil, fmt.Errorf("bundle circuit profile %+v doesn't match this verifier", manifest.Profile)
+	}
+	if _, ok := manifest.Checksums[manifest.ProofFile]; !ok {
+		return nil, fmt.Errorf("bundle has no checksum of %s", manifest.ProofFile)
+	}
+	for name, checksum := range manifest.Checksums {
+		if !isLocalPath(name) {
+			return nil, fmt.Errorf("bundle file %s is outside of the bundle", name)
+		}
+		content, err = ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if Sha256Hex(content) != checksum {
+			return nil, fmt.Errorf("checksum of bundle file %s mismatch", name)
+		}
+	}
+	return manifest, nil
+}
+
+// VerifierConfig returns the config which verifies the batch proofs of the bundle in dir
+// with the verifying keys in keyDir, the keys of the bundle if empty.
+func (m *Manifest) VerifierConfig(dir string, keyDir string) *verifierConfig.Config {
+	if keyDir == "" {
+		keyDir = filepath.Join(dir, KeyDir)
+	}
+	config := &verifierConfig.Config{}
+	config.SetDefaults()
+	config.ProofTable = filepath.Join(dir, m.ProofFile)
+	config.ZkKeyName = filepath.Join(keyDir, m.Profile.ZkKeyName)
+	config.CexAssetsInfo = m.CexAssetsInfo
+	config.CexTotalEquity = m.CexTotalEquity
+	config.CexTotalDebt = m.CexTotalDebt
+	config.VerifyingKeyHashes = m.VerifyingKeys
+	config.AccountTreeRoot = m.AccountTreeRoot
+	return config
+}
+
+// ReadProofs reads the proof table file path, csv or json by its extension.
+func ReadProofs(path string) ([]*Proof, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var proofs []*Proof
+	if filepath.Ext(path) == "."+FormatJson {
+		err = json.Unmarshal(content, &proofs)
+	} else {
+		err = gocsv.UnmarshalBytes(content, &proofs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse proof table %s failed: %w", path, err)
+	}
+	return proofs, nil
+}
+
+// HashVerifyingKey returns the sha256 of the verifying key file of zkKeyName.
+func HashVerifyingKey(zkKeyName string) (string, error) {
+	content, err := ioutil.ReadFile(zkKeyName + ".vk.save")
+	if err != nil {
+		return "", err
+	}
+	return Sha256Hex(content), nil
+}
+
+func Sha256Hex(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
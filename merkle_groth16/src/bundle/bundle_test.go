@@ -0,0 +1,143 @@
+package bundle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteLoad(t *testing.T) {
+	proofs := []*Proof{
+		{BatchNumber: 0, ZkProof: "cHJvb2Yw", CexAssetCommitment: []string{"YQ==", "Yg=="},
+			AccountTreeRoots: []string{"cg==", "cw=="}, BatchCommitment: "Yw==", ZkKeyName: "zkpor500"},
+		{BatchNumber: 1, ZkProof: "cHJvb2Yx", CexAssetCommitment: []string{"Yg==", "ZA=="},
+			AccountTreeRoots: []string{"cw==", "dA=="}, BatchCommitment: "ZQ==", ZkKeyName: "zkpor20_8"},
+	}
+	for _, format := range []string{FormatCsv, FormatJson} {
+		dir := filepath.Join(t.TempDir(), "bundle")
+		manifest := &Manifest{
+			Profile:       CurrentProfile("/keys/zkpor500"),
+			VerifyingKeys: map[string]string{"zkpor500": "aa", "zkpor20_8": "bb"},
+		}
+		err := Write(dir, format, manifest, proofs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if loaded.ProofCounts != 2 || loaded.Profile.ZkKeyName != "zkpor500" || loaded.VerifyingKeys["zkpor20_8"] != "bb" {
+			t.Fatalf("%s: unexpected manifest %+v", format, loaded)
+		}
+		config := loaded.VerifierConfig(dir, "/keys")
+		if config.ZkKeyName != "/keys/zkpor500" || config.SummaryZkKeyName == "" {
+			t.Fatalf("%s: unexpected verifier config %+v", format, config)
+		}
+		read, err := ReadProofs(config.ProofTable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, proofs) {
+			t.Fatalf("%s: proofs %+v are read as %+v", format, proofs, read)
+		}
+
+		// a changed proof file fails its checksum
+		proofFile := filepath.Join(dir, loaded.ProofFile)
+		content, _ := ioutil.ReadFile(proofFile)
+		err = os.WriteFile(proofFile, append(content, ' '), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = Load(dir); err == nil {
+			t.Fatalf("%s: a changed bundle is loaded", format)
+		}
+	}
+
+	dir := t.TempDir()
+	profile := CurrentProfile("zkpor500")
+	profile.AssetCounts++
+	err := Write(dir, FormatJson, &Manifest{Profile: profile}, proofs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Load(dir); err == nil {
+		t.Fatal("a bundle of another circuit profile is loaded")
+	}
+}
+
+func TestSignedArchive(t *testing.T) {
+	keyDir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(keyDir, "zkpor500.vk.save"), []byte("vk"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	manifest := &Manifest{Profile: CurrentProfile("zkpor500"), AccountTreeRoot: "ab"}
+	err = AddVerifyingKey(dir, manifest, filepath.Join(keyDir, "zkpor500"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Write(dir, FormatJson, manifest, []*Proof{{ZkKeyName: "zkpor500"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, publicKeyHex, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := ParsePrivateKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ParsePublicKey(publicKeyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifySignature(dir, publicKey); err == nil {
+		t.Fatal("an unsigned bundle passes the signature check")
+	}
+	err = Sign(dir, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	err = Pack(dir, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, bundleDir, cleanup, err := Open(archive, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := loaded.VerifierConfig(bundleDir, "")
+	if config.AccountTreeRoot != "ab" || config.VerifyingKeyHashes["zkpor500"] != Sha256Hex([]byte("vk")) {
+		t.Fatalf("unexpected verifier config %+v", config)
+	}
+	hash, err := HashVerifyingKey(config.ZkKeyName)
+	if err != nil || hash != config.VerifyingKeyHashes["zkpor500"] {
+		t.Fatalf("the verifying key of the bundle is not unpacked: %v", err)
+	}
+	cleanup()
+	if _, err = os.Stat(bundleDir); !os.IsNotExist(err) {
+		t.Fatal("the unpacked bundle is not removed")
+	}
+
+	// another key or a changed manifest fails the signature check
+	_, otherKey, _ := GenerateKey()
+	publicKey2, _ := ParsePublicKey(otherKey)
+	if _, _, _, err = Open(dir, publicKey2); err == nil {
+		t.Fatal("a bundle signed by another key is opened")
+	}
+	content, _ := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	err = ioutil.WriteFile(filepath.Join(dir, ManifestFile), append(content, ' '), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = Open(dir, publicKey); err == nil {
+		t.Fatal("a changed manifest is opened")
+	}
+}
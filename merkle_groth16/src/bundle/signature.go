@@ -0,0 +1,161 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	SignatureFile    = "manifest.sig"
+	SignatureEd25519 = "ed25519"
+)
+
+// Signature is the signature of the manifest.json bytes of a bundle.
+type Signature struct {
+	Algorithm string
+	PublicKey string // hex, informational, the verifier checks with the key it trusts
+	Signature string // hex
+}
+
+// GenerateKey returns a new ed25519 key pair as the hex of the private key seed and of the
+// public key.
+func GenerateKey() (seed string, publicKey string, err error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(private.Seed()), hex.EncodeToString(public), nil
+}
+
+// ParsePrivateKey parses the hex of an ed25519 private key seed or private key.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	}
+	return nil, fmt.Errorf("invalid signing key of %d bytes", len(b))
+}
+
+// ParsePublicKey parses the hex of an ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key of %d bytes", len(b))
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// LoadPublicKey parses s as the hex of an ed25519 public key or else reads it from the
+// file s.
+func LoadPublicKey(s string) (ed25519.PublicKey, error) {
+	if publicKey, err := ParsePublicKey(s); err == nil {
+		return publicKey, nil
+	}
+	content, err := ioutil.ReadFile(s)
+	if err != nil {
+		return nil, fmt.Errorf("public key %s is neither hex nor a readable file: %w", s, err)
+	}
+	return ParsePublicKey(string(content))
+}
+
+// Sign signs the manifest of the bundle in dir with privateKey into manifest.sig.
+func Sign(dir string, privateKey ed25519.PrivateKey) error {
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(Signature{
+		Algorithm: SignatureEd25519,
+		PublicKey: hex.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+		Signature: hex.EncodeToString(ed25519.Sign(privateKey, manifest)),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, SignatureFile), content, 0644)
+}
+
+// VerifySignature checks that the manifest of the bundle in dir is signed by publicKey.
+func VerifySignature(dir string, publicKey ed25519.PublicKey) error {
+	content, err := ioutil.ReadFile(filepath.Join(dir, SignatureFile))
+	if os.IsNotExist(err) {
+		return errors.New("the bundle is not signed")
+	} else if err != nil {
+		return err
+	}
+	signature := &Signature{}
+	err = json.Unmarshal(content, signature)
+	if err != nil {
+		return fmt.Errorf("parse bundle signature failed: %w", err)
+	}
+	if signature.Algorithm != SignatureEd25519 {
+		return fmt.Errorf("unknown signature algorithm %s", signature.Algorithm)
+	}
+	sig, err := hex.DecodeString(signature.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid bundle signature: %w", err)
+	}
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, manifest, sig) {
+		return errors.New("the bundle signature doesn't match the public key")
+	}
+	return nil
+}
+
+// Open opens the bundle at path, a directory or a tar.gz archive which is extracted into
+// a temporary directory removed by cleanup. The signature of the manifest is checked with
+// publicKey before anything else is read, an unsigned bundle is only opened if publicKey
+// is nil. It returns the manifest and the directory of the bundle.
+func Open(path string, publicKey ed25519.PublicKey) (manifest *Manifest, dir string, cleanup func(), err error) {
+	cleanup = func() {}
+	dir = path
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", cleanup, err
+	}
+	if !info.IsDir() {
+		dir, err = ioutil.TempDir("", "zkpor-bundle")
+		if err != nil {
+			return nil, "", cleanup, err
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		err = Unpack(path, dir)
+		if err != nil {
+			cleanup()
+			return nil, "", func() {}, err
+		}
+	}
+	if publicKey != nil {
+		err = VerifySignature(dir, publicKey)
+		if err != nil {
+			cleanup()
+			return nil, "", func() {}, err
+		}
+	}
+	manifest, err = Load(dir)
+	if err != nil {
+		cleanup()
+		return nil, "", func() {}, err
+	}
+	return manifest, dir, cleanup, nil
+}
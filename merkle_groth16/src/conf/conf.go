@@ -0,0 +1,153 @@
+// Package conf loads the configs of the services in layers: the defaults of the config, the
+// json, yaml or toml file and the environment variables, and validates the result.
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables which override config fields, the variable
+// of a field is EnvPrefix, the field names of its path and underscores in upper case, e.g.
+// ZKPOR_MYSQLDATASOURCE or ZKPOR_TREEDB_OPTION_ADDR.
+const EnvPrefix = "ZKPOR"
+
+// Defaulter is a config with defaults for the fields missing in its file.
+type Defaulter interface {
+	SetDefaults()
+}
+
+// Validator is a config which checks its fields after they are loaded.
+type Validator interface {
+	Validate() error
+}
+
+// Load sets the defaults of config, a pointer to a struct, unmarshals the file path into
+// it, applies the environment overrides and validates it. The format of the file is json,
+// yaml or toml by its extension, the keys are the field names in all of them.
+func Load(path string, config interface{}) error {
+	if d, ok := config.(Defaulter); ok {
+		d.SetDefaults()
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = unmarshal(filepath.Ext(path), content, config)
+	if err != nil {
+		return fmt.Errorf("parse config %s failed: %w", path, err)
+	}
+	err = ApplyEnv(config, EnvPrefix)
+	if err != nil {
+		return err
+	}
+	if v, ok := config.(Validator); ok {
+		err = v.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// unmarshal decodes yaml and toml into generic maps and those by json, so the fields are
+// matched the same way in all the formats.
+func unmarshal(ext string, content []byte, config interface{}) error {
+	var values map[string]interface{}
+	switch strings.ToLower(ext) {
+	case ".json", "":
+		return json.Unmarshal(content, config)
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			return err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(content, &values); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown config format %s", ext)
+	}
+	content, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, config)
+}
+
+// MustLoad is Load which panics on errors.
+func MustLoad(path string, config interface{}) {
+	err := Load(path, config)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// ApplyEnv sets the string, bool and number fields of config, also of nested structs, from
+// the environment variables named after prefix and their path.
+func ApplyEnv(config interface{}, prefix string) error {
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a pointer to a struct")
+	}
+	return applyEnv(v.Elem(), prefix)
+}
+
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(field.Name)
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			err := applyEnv(fv, name)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		var err error
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(value)
+		case reflect.Bool:
+			var b bool
+			b, err = strconv.ParseBool(value)
+			fv.SetBool(b)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			var n int64
+			n, err = strconv.ParseInt(value, 10, fv.Type().Bits())
+			fv.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var n uint64
+			n, err = strconv.ParseUint(value, 10, fv.Type().Bits())
+			fv.SetUint(n)
+		case reflect.Float32, reflect.Float64:
+			var f float64
+			f, err = strconv.ParseFloat(value, fv.Type().Bits())
+			fv.SetFloat(f)
+		default:
+			return fmt.Errorf("%s can't override the %s field %s", name, fv.Kind(), field.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testConfig struct {
+	MysqlDataSource string
+	Workers         int
+	TreeDB          struct {
+		Driver string
+		Option struct {
+			Addr string
+		}
+	}
+	Log struct {
+		SqlDebug bool
+	}
+	Tiers []int
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"MysqlDataSource": "dsn", "Workers": 1, "TreeDB": {"Driver": "redis", "Option": {"Addr": "a"}}, "Tiers": [1]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ZKPOR_WORKERS", "4")
+	t.Setenv("ZKPOR_TREEDB_OPTION_ADDR", "127.0.0.1:6666")
+	t.Setenv("ZKPOR_LOG_SQLDEBUG", "true")
+	config := &testConfig{}
+	err = Load(path, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MysqlDataSource != "dsn" || config.Workers != 4 || config.TreeDB.Driver != "redis" ||
+		config.TreeDB.Option.Addr != "127.0.0.1:6666" || !config.Log.SqlDebug {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	t.Setenv("ZKPOR_WORKERS", "four")
+	if Load(path, &testConfig{}) == nil {
+		t.Fatal("an invalid number is accepted")
+	}
+	os.Unsetenv("ZKPOR_WORKERS")
+	t.Setenv("ZKPOR_TIERS", "1,2")
+	if Load(path, &testConfig{}) == nil {
+		t.Fatal("a slice is overridden")
+	}
+}
+
+type validatedConfig struct {
+	ZkKeyName string
+	Workers   int
+}
+
+func (c *validatedConfig) SetDefaults() {
+	c.Workers = 1
+}
+
+func (c *validatedConfig) Validate() error {
+	if c.ZkKeyName == "" {
+		return errors.New("ZkKeyName is empty")
+	}
+	return nil
+}
+
+func TestLoadFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `{"ZkKeyName": "zkpor500"}`,
+		"config.yaml": "ZkKeyName: zkpor500\n",
+		"config.toml": "ZkKeyName = \"zkpor500\"\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := &validatedConfig{}
+		err = Load(path, config)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if config.ZkKeyName != "zkpor500" || config.Workers != 1 {
+			t.Fatalf("%s: unexpected config %+v", name, config)
+		}
+	}
+
+	path := filepath.Join(dir, "empty.yaml")
+	err := os.WriteFile(path, []byte("Workers: 2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Load(path, &validatedConfig{}) == nil {
+		t.Fatal("an invalid config is accepted")
+	}
+	t.Setenv("ZKPOR_ZKKEYNAME", "zkpor500")
+	config := &validatedConfig{}
+	if err = Load(path, config); err != nil || config.Workers != 2 {
+		t.Fatalf("unexpected config %+v, %v", config, err)
+	}
+}
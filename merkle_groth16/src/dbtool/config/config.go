@@ -1,12 +1,32 @@
 package config
 
+import (
+	"errors"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
 type Config struct {
-	MysqlDataSource string
+	DbDriver        string // mysql, postgres or sqlite, mysql if empty
+	MysqlDataSource string // dsn of DbDriver
 	DbSuffix        string
-	TreeDB          struct {
-		Driver string
-		Option struct {
-			Addr string
-		}
+	Log             utils.LogConfig
+	TreeDB          utils.TreeDBConfig
+}
+
+func (c *Config) SetDefaults() {
+	c.Log.SetDefaults()
+}
+
+func (c *Config) Validate() error {
+	if err := utils.ValidateDbDriver(c.DbDriver); err != nil {
+		return err
+	}
+	if c.MysqlDataSource == "" {
+		return errors.New("MysqlDataSource is empty")
+	}
+	if err := c.TreeDB.Validate(); err != nil {
+		return err
 	}
+	return c.Log.Validate()
 }
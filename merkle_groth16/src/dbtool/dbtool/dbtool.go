@@ -0,0 +1,163 @@
+package dbtool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"merkleverifytool/merkle_groth16/src/dbtool/config"
+	"merkleverifytool/merkle_groth16/src/prover/prover"
+	"merkleverifytool/merkle_groth16/src/userproof/model"
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/witness/witness"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// DeleteAll drops the witness, checkpoint, proof and userproof tables.
+func DeleteAll(dbtoolConfig *config.Config) {
+	db, err := utils.OpenDB(dbtoolConfig.DbDriver, dbtoolConfig.MysqlDataSource, dbtoolConfig.Log)
+	if err != nil {
+		panic(err.Error())
+	}
+	witnessModel := witness.NewWitnessModel(db, dbtoolConfig.DbSuffix)
+	err = witnessModel.DropBatchWitnessTable()
+	if err != nil {
+		logx.Errorw("drop witness table failed", logx.Field("error", err.Error()))
+		panic(err.Error())
+	}
+	logx.Info("drop witness table successfully")
+	err = witnessModel.DropCheckpointTable()
+	if err != nil {
+		logx.Errorw("drop witness checkpoint table failed", logx.Field("error", err.Error()))
+		panic(err.Error())
+	}
+	logx.Info("drop witness checkpoint table successfully")
+
+	proofModel := prover.NewProofModel(db, dbtoolConfig.DbSuffix)
+	err = proofModel.DropProofTable()
+	if err != nil {
+		logx.Errorw("drop proof table failed", logx.Field("error", err.Error()))
+		panic(err.Error())
+	}
+	logx.Info("drop proof table successfully")
+
+	userProofModel := model.NewUserProofModel(db, dbtoolConfig.DbSuffix)
+	err = userProofModel.DropUserProofTable()
+	if err != nil {
+		logx.Errorw("drop userproof table failed", logx.Field("error", err.Error()))
+		panic(err.Error())
+	}
+	logx.Info("drop userproof table successfully")
+}
+
+// FlushKvrocks deletes all the data of the kvrocks tree db.
+func FlushKvrocks(dbtoolConfig *config.Config) {
+	client := redis.NewClient(&redis.Options{
+		Addr:            dbtoolConfig.TreeDB.Option.Addr,
+		PoolSize:        500,
+		MaxRetries:      5,
+		MinRetryBackoff: 8 * time.Millisecond,
+		MaxRetryBackoff: 512 * time.Millisecond,
+		DialTimeout:     10 * time.Second,
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    10 * time.Second,
+		PoolTimeout:     15 * time.Second,
+		IdleTimeout:     5 * time.Minute,
+	})
+	client.FlushAll(context.Background())
+	logx.Info("kvrocks data drop successfully")
+}
+
+// CheckProverStatus logs the batch witness counts by status and the unproven batches.
+func CheckProverStatus(dbtoolConfig *config.Config) {
+	db, err := utils.OpenDB(dbtoolConfig.DbDriver, dbtoolConfig.MysqlDataSource, dbtoolConfig.Log)
+	if err != nil {
+		panic(err.Error())
+	}
+	witnessModel := witness.NewWitnessModel(db, dbtoolConfig.DbSuffix)
+	proofModel := prover.NewProofModel(db, dbtoolConfig.DbSuffix)
+
+	witnessCounts, err := witnessModel.GetRowCounts()
+	if err != nil {
+		panic(err.Error())
+	}
+	proofCounts, err := proofModel.GetRowCounts()
+	if err != nil {
+		panic(err.Error())
+	}
+	logx.Infow("prover status", logx.Field("total", witnessCounts[0]), logx.Field("published", witnessCounts[1]),
+		logx.Field("pending", witnessCounts[2]), logx.Field("finished", witnessCounts[3]), logx.Field("failed", witnessCounts[4]),
+		logx.Field("unproven", witnessCounts[0]-proofCounts))
+}
+
+// ListFailedWitness logs the batch witnesses which failed all proving attempts.
+func ListFailedWitness(dbtoolConfig *config.Config) {
+	db, err := utils.OpenDB(dbtoolConfig.DbDriver, dbtoolConfig.MysqlDataSource, dbtoolConfig.Log)
+	if err != nil {
+		panic(err.Error())
+	}
+	witnessModel := witness.NewWitnessModel(db, dbtoolConfig.DbSuffix)
+	failedWitnesses, err := witnessModel.GetFailedBatchWitnesses()
+	if err != nil {
+		panic(err.Error())
+	}
+	logx.Infow("failed witness items", logx.Field("counts", len(failedWitnesses)))
+	for _, w := range failedWitnesses {
+		logx.Infow("failed witness", logx.Field("height", w.Height), logx.Field("attempts", w.Attempts),
+			logx.Field("failedAt", w.UpdatedAt.Format(time.RFC3339)), logx.Field("error", w.ErrorMessage))
+	}
+}
+
+// QueryCexAssets prints the cex assets of the latest batch witness and writes them with the
+// cex total equity and debt into the verifier config at verifierConfigPath.
+func QueryCexAssets(dbtoolConfig *config.Config, verifierConfigPath string) {
+	db, err := utils.OpenDB(dbtoolConfig.DbDriver, dbtoolConfig.MysqlDataSource, dbtoolConfig.Log)
+	if err != nil {
+		panic(err.Error())
+	}
+	witnessModel := witness.NewWitnessModel(db, dbtoolConfig.DbSuffix)
+	latestWitness, err := witnessModel.GetLatestBatchWitness()
+	if err != nil {
+		panic(err.Error())
+	}
+	witness := utils.DecodeBatchWitness(latestWitness.WitnessData)
+	if witness == nil {
+		panic("decode invalid witness data")
+	}
+	cexAssetsInfo := utils.RecoverAfterCexAssets(witness)
+	totalCexAssets := utils.RecoverAfterTotalCexAssets(witness)
+	var newAssetsInfo []utils.CexAssetInfo
+	for i := 0; i < len(cexAssetsInfo); i++ {
+		newAssetsInfo = append(newAssetsInfo, cexAssetsInfo[i])
+	}
+	cexAssetsInfoBytes, _ := json.MarshalIndent(newAssetsInfo, "", "  ")
+	fmt.Println(string(cexAssetsInfoBytes))
+	var newResults []map[string]interface{}
+	err = json.Unmarshal(cexAssetsInfoBytes, &newResults)
+	if err != nil {
+		panic(err.Error())
+	}
+	content, err := ioutil.ReadFile(verifierConfigPath)
+	if err != nil {
+		panic(err.Error())
+	}
+	var results map[string]interface{}
+	err = json.Unmarshal(content, &results)
+	if err != nil {
+		panic(err.Error())
+	}
+	results["CexAssetsInfo"] = newResults
+	results["CexTotalEquity"] = totalCexAssets.AfterCEXTotalEquity
+	results["CexTotalDebt"] = totalCexAssets.AfterCEXTotalDebt
+	bytevalue, err := json.Marshal(results)
+	if err != nil {
+		panic(err.Error())
+	}
+	err = ioutil.WriteFile(verifierConfigPath, bytevalue, 0644)
+	if err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+type Config struct {
+	DbDriver        string // mysql, postgres or sqlite, mysql if empty
+	MysqlDataSource string // dsn of DbDriver
+	DbSuffix        string
+	ZkKeyName       string // the verifying keys of the proofs are hashed from its directory
+	Format          string // csv or json
+	OutputFile      string // tar.gz archive of the bundle
+	// secret spec of the hex ed25519 signing key of the bundle, env:NAME, file:PATH,
+	// vault:PATH#KEY or aws:SECRET_ID#KEY
+	SigningKey string
+	// time of the user balances, the creation time of the last witness if zero
+	SnapshotTime time.Time
+	Log          utils.LogConfig
+}
+
+func (c *Config) SetDefaults() {
+	c.Log.SetDefaults()
+	c.Format = "csv"
+}
+
+func (c *Config) Validate() error {
+	if err := utils.ValidateDbDriver(c.DbDriver); err != nil {
+		return err
+	}
+	if c.MysqlDataSource == "" {
+		return errors.New("MysqlDataSource is empty")
+	}
+	if err := utils.ValidateZkKeyName(c.ZkKeyName); err != nil {
+		return err
+	}
+	if c.Format != "csv" && c.Format != "json" {
+		return fmt.Errorf("unknown Format %q, csv or json", c.Format)
+	}
+	if c.OutputFile == "" {
+		return errors.New("OutputFile is empty")
+	}
+	if c.SigningKey == "" {
+		return errors.New("SigningKey is empty")
+	}
+	return c.Log.Validate()
+}
@@ -0,0 +1,152 @@
+package export
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"merkleverifytool/merkle_groth16/src/bundle"
+	"merkleverifytool/merkle_groth16/src/export/config"
+	"merkleverifytool/merkle_groth16/src/prover/prover"
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/witness/witness"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// Export writes the signed bundle of the proofs and verifying keys of all batches into
+// the archive exportConfig.OutputFile, it fails unless the witness service completed and
+// every batch is proven.
+func Export(exportConfig *config.Config) error {
+	secret, err := utils.GetSecret(context.Background(), exportConfig.SigningKey)
+	if err != nil {
+		return fmt.Errorf("get signing key failed: %w", err)
+	}
+	signingKey, err := bundle.ParsePrivateKey(secret)
+	if err != nil {
+		return err
+	}
+	db, err := utils.OpenDB(exportConfig.DbDriver, exportConfig.MysqlDataSource, exportConfig.Log)
+	if err != nil {
+		return err
+	}
+	witnessModel := witness.NewWitnessModel(db, exportConfig.DbSuffix)
+	proofModel := prover.NewProofModel(db, exportConfig.DbSuffix)
+
+	completed, err := witnessModel.IsBatchWitnessCompleted()
+	if err != nil {
+		return err
+	}
+	if !completed {
+		return fmt.Errorf("the witness service hasn't completed")
+	}
+	latestWitness, err := witnessModel.GetLatestBatchWitness()
+	if err != nil {
+		return err
+	}
+	rows, err := proofModel.GetProofsBetween(0, latestWitness.Height)
+	if err != nil {
+		return err
+	}
+	if int64(len(rows)) != latestWitness.Height+1 {
+		return fmt.Errorf("only %d of %d batches are proven", len(rows), latestWitness.Height+1)
+	}
+
+	dir, err := ioutil.TempDir("", "zkpor-export")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	manifest := &bundle.Manifest{
+		CreatedAt:    time.Now().UTC(),
+		SnapshotTime: exportConfig.SnapshotTime.UTC(),
+		Profile:      bundle.CurrentProfile(exportConfig.ZkKeyName),
+	}
+	if exportConfig.SnapshotTime.IsZero() {
+		manifest.SnapshotTime = latestWitness.CreatedAt.UTC()
+	}
+	keyDir := filepath.Dir(exportConfig.ZkKeyName)
+	proofs := make([]*bundle.Proof, len(rows))
+	for i, row := range rows {
+		proof := &bundle.Proof{
+			BatchNumber:     row.BatchNumber,
+			ZkProof:         row.ProofInfo,
+			BatchCommitment: row.BatchCommitment,
+			ZkKeyName:       filepath.Base(row.ZkKeyName),
+		}
+		if row.ZkKeyName == "" {
+			proof.ZkKeyName = manifest.Profile.ZkKeyName
+		}
+		err = json.Unmarshal([]byte(row.CexAssetListCommitments), &proof.CexAssetCommitment)
+		if err != nil {
+			return fmt.Errorf("decode cex asset commitments of batch %d failed: %w", row.BatchNumber, err)
+		}
+		err = json.Unmarshal([]byte(row.AccountTreeRoots), &proof.AccountTreeRoots)
+		if err != nil {
+			return fmt.Errorf("decode account tree roots of batch %d failed: %w", row.BatchNumber, err)
+		}
+		if _, ok := manifest.VerifyingKeys[proof.ZkKeyName]; !ok {
+			err = bundle.AddVerifyingKey(dir, manifest, filepath.Join(keyDir, proof.ZkKeyName))
+			if err != nil {
+				return err
+			}
+		}
+		proofs[i] = proof
+	}
+	// the user inclusion keys are published with the batch keys, so that third parties can
+	// pin the verifying keys of user inclusion proofs to the signed manifest
+	for _, userAssetCounts := range utils.UserAssetCountsTiers {
+		zkKeyName := utils.GetUserInclusionZkKeyName(filepath.Join(keyDir, utils.UserInclusionZkKeyName), userAssetCounts)
+		if _, err := os.Stat(zkKeyName + ".vk.save"); os.IsNotExist(err) {
+			logx.Infow("no user inclusion verifying key to export", logx.Field("zkKeyName", zkKeyName))
+			continue
+		}
+		err = bundle.AddVerifyingKey(dir, manifest, zkKeyName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(proofs) > 0 {
+		roots := proofs[len(proofs)-1].AccountTreeRoots
+		if len(roots) != 2 {
+			return fmt.Errorf("batch %d has %d account tree roots", len(proofs)-1, len(roots))
+		}
+		root, err := base64.StdEncoding.DecodeString(roots[1])
+		if err != nil {
+			return fmt.Errorf("decode account tree root of batch %d failed: %w", len(proofs)-1, err)
+		}
+		manifest.AccountTreeRoot = hex.EncodeToString(root)
+	}
+
+	batchWitness := utils.DecodeBatchWitness(latestWitness.WitnessData)
+	if batchWitness == nil {
+		return fmt.Errorf("decode invalid witness data")
+	}
+	manifest.CexAssetsInfo = utils.RecoverAfterCexAssets(batchWitness)
+	totalCexAssets := utils.RecoverAfterTotalCexAssets(batchWitness)
+	manifest.CexTotalEquity = totalCexAssets.AfterCEXTotalEquity
+	manifest.CexTotalDebt = totalCexAssets.AfterCEXTotalDebt
+
+	err = bundle.Write(dir, exportConfig.Format, manifest, proofs)
+	if err != nil {
+		return err
+	}
+	err = bundle.Sign(dir, signingKey)
+	if err != nil {
+		return err
+	}
+	err = bundle.Pack(dir, exportConfig.OutputFile)
+	if err != nil {
+		return err
+	}
+	logx.Infow("proof bundle exported", logx.Field("file", exportConfig.OutputFile), logx.Field("proofs", len(proofs)),
+		logx.Field("verifyingKeys", len(manifest.VerifyingKeys)), logx.Field("accountTreeRoot", manifest.AccountTreeRoot))
+	return nil
+}
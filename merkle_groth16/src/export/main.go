@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+
+	"merkleverifytool/merkle_groth16/src/conf"
+	"merkleverifytool/merkle_groth16/src/export/config"
+	"merkleverifytool/merkle_groth16/src/export/export"
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+func main() {
+	defer utils.LogPanic()
+	remotePasswdConfig := flag.String("remote_password_config", "", "mysql password secret: env:NAME, file:PATH, vault:PATH#KEY, aws:SECRET_ID?region=REGION#KEY or an aws secret id")
+	flag.Parse()
+	exportConfig := &config.Config{}
+	conf.MustLoad("src/export/config/config.json", exportConfig)
+	utils.SetupLogger("export", exportConfig.Log)
+	if *remotePasswdConfig != "" {
+		s, err := utils.GetDataSource(exportConfig.DbDriver, exportConfig.MysqlDataSource, *remotePasswdConfig)
+		if err != nil {
+			panic(err.Error())
+		}
+		exportConfig.MysqlDataSource = s
+	}
+	err := export.Export(exportConfig)
+	if err != nil {
+		panic(err.Error())
+	}
+}
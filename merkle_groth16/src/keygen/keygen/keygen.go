@@ -0,0 +1,82 @@
+package keygen
+
+import (
+	"errors"
+	"fmt"
+	"merkleverifytool/merkle_groth16/circuit"
+	"merkleverifytool/merkle_groth16/src/utils"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+// ValidateKeyParams checks that the asset slots and the batch size are circuit tiers the
+// witness and prover services can select.
+func ValidateKeyParams(userAssetCounts int, batchCounts int) error {
+	if !containsTier(utils.UserAssetCountsTiers, userAssetCounts) {
+		return fmt.Errorf("user assets %d is not one of the tiers %v", userAssetCounts, utils.UserAssetCountsTiers)
+	}
+	if !containsTier(utils.BatchCreateUserOpsCountsTiers, batchCounts) {
+		return fmt.Errorf("batch %d is not one of the tiers %v", batchCounts, utils.BatchCreateUserOpsCountsTiers)
+	}
+	return nil
+}
+
+// ValidateCircuitFlags checks that at most one of the circuits is selected.
+func ValidateCircuitFlags(summary bool, userInclusion bool) error {
+	if summary && userInclusion {
+		return errors.New("summary can't be combined with user inclusion")
+	}
+	return nil
+}
+
+func containsTier(tiers []int, counts int) bool {
+	for _, t := range tiers {
+		if t == counts {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateKeys compiles the circuit and dumps its r1cs, proving and verifying keys into the
+// working directory: the cex summary circuit if summary is set, the user inclusion circuit
+// of userAssetCounts slots if userInclusion is set, otherwise the batch circuit of
+// batchCounts users with userAssetCounts slots.
+func GenerateKeys(summary bool, userInclusion bool, userAssetCounts int, batchCounts int) {
+	var batchCircuit frontend.Circuit
+	zkKeyName := "zkpor" + strconv.FormatInt(utils.BatchCreateUserOpsCounts, 10)
+	if summary {
+		batchCircuit = circuit.NewCexSummaryCircuit(utils.AssetCounts)
+		zkKeyName = "zkpor_summary"
+	} else if userInclusion {
+		batchCircuit = circuit.NewUserInclusionCircuit(uint32(userAssetCounts), utils.UserInclusionClaimCounts)
+		zkKeyName = utils.GetUserInclusionZkKeyName(utils.UserInclusionZkKeyName, userAssetCounts)
+	} else {
+		batchCircuit = circuit.NewBatchCreateUserCircuit(utils.AssetCounts, uint32(userAssetCounts), uint32(batchCounts))
+		zkKeyName = utils.GetZkKeyName(zkKeyName, batchCounts, userAssetCounts)
+	}
+	oR1cs, err := frontend.Compile(ecc.BN254, r1cs.NewBuilder, batchCircuit)
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		for {
+			select {
+			case <-time.After(time.Second * 10):
+				runtime.GC()
+			}
+		}
+	}()
+	fmt.Println(oR1cs.GetNbVariables())
+	fmt.Printf("Number of constraints: %d\n", oR1cs.GetNbConstraints())
+	err = groth16.SetupLazyWithDump(oR1cs, zkKeyName)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -1,38 +1,24 @@
 package main
 
 import (
-	"fmt"
-	"merkleverifytool/merkle_groth16/circuit"
+	"flag"
+	"merkleverifytool/merkle_groth16/src/keygen/keygen"
 	"merkleverifytool/merkle_groth16/src/utils"
-	"runtime"
-	"strconv"
-	"time"
-
-	"github.com/consensys/gnark-crypto/ecc"
-	"github.com/consensys/gnark/backend/groth16"
-	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
 )
 
 func main() {
-	circuit := circuit.NewBatchCreateUserCircuit(utils.AssetCounts, utils.BatchCreateUserOpsCounts)
-	oR1cs, err := frontend.Compile(ecc.BN254, r1cs.NewBuilder, circuit)
+	summaryFlag := flag.Bool("summary", false, "generate keys of the cex summary circuit")
+	userInclusionFlag := flag.Bool("user_inclusion", false, "generate keys of the user inclusion circuit")
+	userAssetCounts := flag.Int("user_assets", utils.AssetCounts, "asset slots per user, one of utils.UserAssetCountsTiers")
+	batchCounts := flag.Int("batch", utils.BatchCreateUserOpsCounts, "users per batch, one of utils.BatchCreateUserOpsCountsTiers")
+	flag.Parse()
+	err := keygen.ValidateCircuitFlags(*summaryFlag, *userInclusionFlag)
 	if err != nil {
-		panic(err)
+		panic(err.Error())
 	}
-	go func() {
-		for {
-			select {
-			case <-time.After(time.Second * 10):
-				runtime.GC()
-			}
-		}
-	}()
-	fmt.Println(oR1cs.GetNbVariables())
-	zkKeyName := "zkpor" + strconv.FormatInt(utils.BatchCreateUserOpsCounts, 10)
-	fmt.Printf("Number of constraints: %d\n", oR1cs.GetNbConstraints())
-	err = groth16.SetupLazyWithDump(oR1cs, zkKeyName)
+	err = keygen.ValidateKeyParams(*userAssetCounts, *batchCounts)
 	if err != nil {
-		panic(err)
+		panic(err.Error())
 	}
+	keygen.GenerateKeys(*summaryFlag, *userInclusionFlag, *userAssetCounts, *batchCounts)
 }
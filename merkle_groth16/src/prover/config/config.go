@@ -1,12 +1,45 @@
 package config
 
+import (
+	"errors"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
 type Config struct {
-	MysqlDataSource string
-	DbSuffix        string
-	Redis           struct {
-		Host     string
-		Type     string
-		Password string
-	}
-	ZkKeyName string
+	DbDriver         string // mysql, postgres or sqlite, mysql if empty
+	MysqlDataSource  string // dsn of DbDriver
+	DbSuffix         string
+	MetricsAddr      string // address of the prometheus metrics endpoint, disabled if empty
+	Log              utils.LogConfig
+	ZkKeyName        string
+	MaxAttempts      int64 // proving attempts of a batch before it fails, utils.BatchWitnessMaxAttempts if 0
+	Workers          int   // concurrent proofs sharing the loaded keys, 1 if 0
+	MemoryLimitMB    int64 // estimated memory of the loaded keys and the concurrent proofs, unlimited if 0
+	SummaryZkKeyName string
+	SummaryProofFile string
+}
+
+func (c *Config) SetDefaults() {
+	c.Log.SetDefaults()
+	c.MaxAttempts = utils.BatchWitnessMaxAttempts
+	c.Workers = 1
+	c.SummaryZkKeyName = "zkpor_summary"
+	c.SummaryProofFile = "summary_proof.json"
+}
+
+func (c *Config) Validate() error {
+	if err := utils.ValidateDbDriver(c.DbDriver); err != nil {
+		return err
+	}
+	if c.MysqlDataSource == "" {
+		return errors.New("MysqlDataSource is empty")
+	}
+	if err := utils.ValidateZkKeyName(c.ZkKeyName); err != nil {
+		return err
+	}
+	if c.MaxAttempts < 0 || c.Workers < 0 || c.MemoryLimitMB < 0 {
+		return errors.New("MaxAttempts, Workers and MemoryLimitMB can't be negative")
+	}
+	return c.Log.Validate()
 }
@@ -1,35 +1,43 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
-	"io/ioutil"
+	"os/signal"
+	"syscall"
 
+	"merkleverifytool/merkle_groth16/src/conf"
 	"merkleverifytool/merkle_groth16/src/prover/config"
 	"merkleverifytool/merkle_groth16/src/prover/prover"
 	"merkleverifytool/merkle_groth16/src/utils"
 )
 
 func main() {
+	defer utils.LogPanic()
 	proverConfig := &config.Config{}
-	content, err := ioutil.ReadFile("src/prover/config/config.json")
-	if err != nil {
-		panic(err.Error())
-	}
-	err = json.Unmarshal(content, proverConfig)
+	conf.MustLoad("src/prover/config/config.json", proverConfig)
+	utils.SetupLogger("prover", proverConfig.Log)
+	remotePasswdConfig := flag.String("remote_password_config", "", "mysql password secret: env:NAME, file:PATH, vault:PATH#KEY, aws:SECRET_ID?region=REGION#KEY or an aws secret id")
+	rerun := flag.Bool("rerun", false, "flag which indicates rerun proof generation")
+	summary := flag.Bool("summary", false, "flag which indicates cex summary proof generation")
+	daemon := flag.Bool("daemon", false, "flag which indicates waiting for new witnesses until the witness service completed")
+	flag.Parse()
+	err := prover.ValidateRunFlags(*rerun, *daemon)
 	if err != nil {
 		panic(err.Error())
 	}
-	remotePasswdConfig := flag.String("remote_password_config", "", "fetch password from aws secretsmanager")
-	rerun := flag.Bool("rerun", false, "flag which indicates rerun proof generation")
-	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	if *remotePasswdConfig != "" {
-		s, err := utils.GetMysqlSource(proverConfig.MysqlDataSource, *remotePasswdConfig)
+		s, err := utils.GetDataSource(proverConfig.DbDriver, proverConfig.MysqlDataSource, *remotePasswdConfig)
 		if err != nil {
 			panic(err.Error())
 		}
 		proverConfig.MysqlDataSource = s
 	}
-	prover := prover.NewProver(proverConfig)
-	prover.Run(*rerun)
+	if *summary {
+		prover.RunCexSummary(proverConfig)
+		return
+	}
+	prover.RunService(ctx, proverConfig, *rerun, *daemon)
 }
@@ -0,0 +1,70 @@
+package prover
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryAdmission admits the proofs of the workers while the memory of the resident keys
+// and the sum of the estimated memory of the proofs stay within limit. A proof which
+// exceeds limit alone is admitted when no other proof runs, so a small limit serializes
+// the proofs instead of blocking them.
+type memoryAdmission struct {
+	mu       sync.Mutex
+	limit    int64 // bytes, 0 is unlimited
+	resident int64 // bytes of the loaded r1cs and keys
+	used     int64
+	running  int
+	changed  chan struct{} // closed and replaced by every release
+}
+
+func newMemoryAdmission(limit int64) *memoryAdmission {
+	return &memoryAdmission{
+		limit:   limit,
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire waits until a proof of size bytes is admitted, it returns false if ctx is
+// cancelled first.
+func (a *memoryAdmission) acquire(ctx context.Context, size int64) bool {
+	for {
+		a.mu.Lock()
+		if a.limit == 0 || a.running == 0 || a.resident+a.used+size <= a.limit {
+			a.used += size
+			a.running++
+			a.mu.Unlock()
+			return true
+		}
+		changed := a.changed
+		a.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// release returns the size bytes of a finished proof.
+func (a *memoryAdmission) release(size int64) {
+	a.mu.Lock()
+	a.used -= size
+	a.running--
+	a.notify()
+	a.mu.Unlock()
+}
+
+// setResident sets the size bytes of the loaded keys, 0 while no keys are loaded.
+func (a *memoryAdmission) setResident(size int64) {
+	a.mu.Lock()
+	a.resident = size
+	a.notify()
+	a.mu.Unlock()
+}
+
+// notify wakes the waiting proofs, a.mu is held.
+func (a *memoryAdmission) notify() {
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
@@ -0,0 +1,62 @@
+package prover
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryAdmission(t *testing.T) {
+	admission := newMemoryAdmission(10)
+	ctx := context.Background()
+	// a proof larger than the limit is admitted alone
+	if !admission.acquire(ctx, 15) {
+		t.Fatal("the first proof is not admitted")
+	}
+
+	admitted := make(chan bool)
+	go func() { admitted <- admission.acquire(ctx, 4) }()
+	select {
+	case <-admitted:
+		t.Fatal("a proof exceeding the limit is admitted")
+	case <-time.After(50 * time.Millisecond):
+	}
+	admission.release(15)
+	if !<-admitted {
+		t.Fatal("the waiting proof is not admitted after the release")
+	}
+	if !admission.acquire(ctx, 6) {
+		t.Fatal("a proof within the limit is not admitted")
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	go func() { admitted <- admission.acquire(cancelCtx, 1) }()
+	cancel()
+	if <-admitted {
+		t.Fatal("a proof is admitted after the cancellation")
+	}
+
+	// the resident keys count against the limit
+	keyed := newMemoryAdmission(10)
+	keyed.setResident(6)
+	if !keyed.acquire(ctx, 3) {
+		t.Fatal("the first proof is not admitted")
+	}
+	go func() { admitted <- keyed.acquire(ctx, 3) }()
+	select {
+	case <-admitted:
+		t.Fatal("a proof exceeding the limit with the keys is admitted")
+	case <-time.After(50 * time.Millisecond):
+	}
+	keyed.setResident(4)
+	if !<-admitted {
+		t.Fatal("the waiting proof is not admitted after the keys shrank")
+	}
+
+	unlimited := newMemoryAdmission(0)
+	for i := 0; i < 3; i++ {
+		if !unlimited.acquire(ctx, 1<<40) {
+			t.Fatal("a proof is not admitted without a limit")
+		}
+	}
+}
@@ -34,7 +34,8 @@ type (
 		CexAssetListCommitments string
 		AccountTreeRoots        string
 		BatchCommitment         string
-		BatchNumber             int64 `gorm:"index:idx_number,unique"`
+		BatchNumber             int64  `gorm:"index:,unique"`
+		ZkKeyName               string // key of the circuit which proves the batch
 	}
 )
 
@@ -69,7 +70,7 @@ func (m *defaultProofModel) CreateProof(row *Proof) error {
 }
 
 func (m *defaultProofModel) GetProofsBetween(start int64, end int64) (proofs []*Proof, err error) {
-	dbTx := m.DB.Debug().Table(m.table).Where("batch_number >= ? AND batch_number <= ?",
+	dbTx := m.DB.Table(m.table).Where("batch_number >= ? AND batch_number <= ?",
 		start,
 		end).
 		Order("batch_number").
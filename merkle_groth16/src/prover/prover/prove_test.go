@@ -0,0 +1,88 @@
+package prover
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+type squareCircuit struct {
+	X frontend.Variable
+	Y frontend.Variable `gnark:",public"`
+}
+
+func (c *squareCircuit) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.Y)
+	return nil
+}
+
+// TestConcurrentProveRoll proves on one shared key set, whose pkB2 is cloned by proveRoll,
+// from several goroutines and verifies the proofs, run it with -race.
+func TestConcurrentProveRoll(t *testing.T) {
+	zkKeyName := filepath.Join(t.TempDir(), "square")
+	ccs, err := frontend.Compile(ecc.BN254, r1cs.NewBuilder, &squareCircuit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = groth16.SetupLazyWithDump(ccs, zkKeyName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provingKey, err := LoadProvingKey(zkKeyName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyingKey, err := LoadVerifyingKey(zkKeyName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sharedB := reflect.ValueOf(provingKey[1]).Elem().FieldByName("G2").FieldByName("B")
+	// the points are kept, so that their memory isn't reused by the points ProveRoll reads
+	sharedPoints := reflect.ValueOf(sharedB.Interface())
+	if sharedB.Len() == 0 {
+		t.Fatal("the G2.B points of pkB2 are empty")
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			x := i + 2
+			fullWitness, err := frontend.NewWitness(&squareCircuit{X: x, Y: x * x}, ecc.BN254)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			publicWitness, err := frontend.NewWitness(&squareCircuit{Y: x * x}, ecc.BN254, frontend.PublicOnly())
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			proof, err := proveRoll(ccs, provingKey, fullWitness, zkKeyName)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = groth16.Verify(proof, verifyingKey, publicWitness)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("proof %d: %v", i, err)
+		}
+	}
+	// ProveRoll replaced the G2.B points of the clones only
+	if sharedB.Pointer() != sharedPoints.Pointer() {
+		t.Fatal("the G2.B points of the shared pkB2 were replaced")
+	}
+}
@@ -2,12 +2,15 @@ package prover
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"runtime"
+	"sync"
 	"time"
 
 	"merkleverifytool/merkle_groth16/circuit"
@@ -17,145 +20,362 @@ import (
 
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/groth16"
+	backendWitness "github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/std"
 	"github.com/zeromicro/go-zero/core/logx"
-	"github.com/zeromicro/go-zero/core/stores/redis"
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
 )
 
-func WithRedis(redisType string, redisPass string) redis.Option {
-	return func(p *redis.Redis) {
-		p.Type = redisType
-		p.Pass = redisPass
-	}
-}
-
 type Prover struct {
 	witnessModel witness.WitnessModel
 	proofModel   ProofModel //※※※※※※
-	redisConn    *redis.Redis
 
-	VerifyingKeys groth16.VerifyingKey
-	ProvingKeys   []groth16.ProvingKey
-	SessionName   string
+	zkKeyName string // key name of the dense circuit, see utils.GetZkKeyName
+	owner     string // the id of this prover in the leases of the witnesses it claims
+
+	maxAttempts int64            // proving attempts of a batch before it is StatusFailed
+	workers     int              // concurrent proofs
+	admission   *memoryAdmission // admits the proofs whose estimated memory fits
+
+	metricsEnabled bool
+
+	// keys of the circuit being proven, shared by the workers. They are switched when a
+	// batch needs another batch size or user asset counts tier and no worker uses them,
+	// keysLoading is set while a worker loads them without holding keysCond.L.
+	keys        *zkKeys
+	keysInUse   int
+	keysLoading bool
+	keysCond    *sync.Cond
+}
+
+// zkKeys are the r1cs and the keys of the circuit named Name.
+type zkKeys struct {
+	Name          string
 	R1cs          frontend.CompiledConstraintSystem
+	ProvingKeys   []groth16.ProvingKey
+	VerifyingKeys groth16.VerifyingKey
+	// estimated bytes of the loaded r1cs and keys and of a proof with them, see loadZkKeys
+	MemoryBytes      int64
+	ProofMemoryBytes int64
 }
 
 func NewProver(config *config.Config) *Prover {
-	redisConn := redis.New(config.Redis.Host, WithRedis(config.Redis.Type, config.Redis.Password))
-	db, err := gorm.Open(mysql.Open(config.MysqlDataSource))
+	db, err := utils.OpenDB(config.DbDriver, config.MysqlDataSource, config.Log)
 	if err != nil {
 		panic(err.Error())
 	}
 	prover := Prover{
 		witnessModel: witness.NewWitnessModel(db, config.DbSuffix),
 		proofModel:   NewProofModel(db, config.DbSuffix),
-		redisConn:    redisConn,
-		SessionName:  config.ZkKeyName,
+		zkKeyName:    config.ZkKeyName,
+		owner:        NewProverOwner(),
+		maxAttempts:  config.MaxAttempts,
+		workers:      config.Workers,
+		admission:    newMemoryAdmission(config.MemoryLimitMB << 20),
+		keysCond:     sync.NewCond(&sync.Mutex{}),
+
+		metricsEnabled: config.MetricsAddr != "",
+	}
+	if prover.maxAttempts <= 0 {
+		prover.maxAttempts = utils.BatchWitnessMaxAttempts
+	}
+	if prover.workers <= 0 {
+		prover.workers = 1
 	}
 
 	std.RegisterHints() //※※※※※
-	fmt.Println("begin loading r1cs...")
+	return &prover
+}
+
+// NewProverOwner returns an id which is unique among the running provers.
+func NewProverOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
+// the polling interval of a daemon prover waiting for witnesses doubles from
+// daemonMinBackoff up to daemonMaxBackoff and is reset by the next claimed witness
+const (
+	daemonMinBackoff = time.Second
+	daemonMaxBackoff = 30 * time.Second
+)
+
+func leaseExpiry() int64 {
+	return time.Now().Unix() + utils.BatchWitnessLeaseSeconds
+}
+
+// failBatchWitness records the failed attempt of this prover to prove batchWitness, which is
+// retried by any prover until it failed maxAttempts times.
+func (p *Prover) failBatchWitness(batchWitness *witness.BatchWitness, err error) {
+	utils.ProverFailuresCounter.Inc()
+	logx.Errorw("prove batch failed", logx.Field("height", batchWitness.Height), logx.Field("error", err.Error()))
+	err = p.witnessModel.FailBatchWitness(batchWitness, p.owner, err.Error(), p.maxAttempts)
+	if err != nil {
+		logx.Errorw("update witness error", logx.Field("height", batchWitness.Height), logx.Field("error", err.Error()))
+		return
+	}
+	if batchWitness.Status == witness.StatusFailed {
+		logx.Errorw("batch failed all attempts, it is not retried", logx.Field("height", batchWitness.Height), logx.Field("attempts", batchWitness.Attempts))
+	} else {
+		logx.Infow("batch failed, it is published again", logx.Field("height", batchWitness.Height), logx.Field("attempts", batchWitness.Attempts),
+			logx.Field("maxAttempts", p.maxAttempts))
+	}
+}
+
+// startHeartbeat renews the lease of the batch witness of height until the returned
+// function is called, which waits for the last renewal, so the status of the witness can
+// be updated afterwards. A lost lease is only reported, a proof of the same batch by
+// another prover is ignored by the unique batch number of the proof table.
+func (p *Prover) startHeartbeat(ctx context.Context, height int64) func() {
+	heartbeatCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(utils.BatchWitnessLeaseSeconds * time.Second / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeatCtx.Done():
+				return
+			case <-ticker.C:
+				err := p.witnessModel.RenewBatchWitnessLease(height, p.owner, leaseExpiry())
+				if err != nil {
+					logx.Errorw("renew lease failed", logx.Field("height", height), logx.Field("error", err.Error()))
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// acquireZkKeys returns the keys of zkKeyName, which are loaded unless they are loaded
+// already. Keys of another circuit are replaced once no worker uses them, the caller has to
+// releaseZkKeys when its proof is done. The other workers wait while the keys are loaded
+// without blocking the release of the keys.
+func (p *Prover) acquireZkKeys(zkKeyName string) *zkKeys {
+	p.keysCond.L.Lock()
+	for p.keysLoading || (p.keys != nil && p.keys.Name != zkKeyName && p.keysInUse > 0) {
+		p.keysCond.Wait()
+	}
+	if p.keys != nil && p.keys.Name == zkKeyName {
+		p.keysInUse++
+		p.keysCond.L.Unlock()
+		return p.keys
+	}
+	// release the keys of the previous tier first
+	p.keys = nil
+	p.keysLoading = true
+	p.keysCond.L.Unlock()
+	p.admission.setResident(0)
+	runtime.GC()
+	keys := loadZkKeys(zkKeyName)
+	p.admission.setResident(keys.MemoryBytes)
+	logx.Infow("zk keys loaded", logx.Field("zkKeyName", zkKeyName), logx.Field("memoryMB", keys.MemoryBytes>>20),
+		logx.Field("proofMemoryMB", keys.ProofMemoryBytes>>20))
+
+	p.keysCond.L.Lock()
+	p.keys = keys
+	p.keysLoading = false
+	p.keysInUse++
+	p.keysCond.L.Unlock()
+	p.keysCond.Broadcast()
+	return keys
+}
+
+func (p *Prover) releaseZkKeys() {
+	p.keysCond.L.Lock()
+	p.keysInUse--
+	p.keysCond.L.Unlock()
+	p.keysCond.Broadcast()
+}
+
+// loadZkKeys loads the r1cs, the proving keys and the verifying key of zkKeyName.
+func loadZkKeys(zkKeyName string) *zkKeys {
+	keys := &zkKeys{Name: zkKeyName}
+	var err error
+	logx.Infow("begin loading r1cs", logx.Field("zkKeyName", zkKeyName))
 	loadR1csChan := make(chan bool)
 	go func() { //※※※※※
 		for {
 
 			select {
 			case <-loadR1csChan:
-				fmt.Println("load r1cs finished...... quit")
+				logx.Debug("load r1cs finished, quit the gc loop")
 				return
 			case <-time.After(time.Second * 10):
 				runtime.GC()
 			}
 		}
 	}()
-	prover.R1cs, err = groth16.LoadR1CSFromFile(config.ZkKeyName)
+	keys.R1cs, err = groth16.LoadR1CSFromFile(zkKeyName)
 	if err != nil {
 		panic("r1cs init error")
 	}
 	loadR1csChan <- true
 	runtime.GC()
-	fmt.Println("finish loading r1cs...")
+	logx.Infow("finish loading r1cs", logx.Field("zkKeyName", zkKeyName))
 	// read proving and verifying keys
-	fmt.Println("begin loading proving key...")
-	prover.ProvingKeys, err = LoadProvingKey(config.ZkKeyName)
+	logx.Infow("begin loading proving key", logx.Field("zkKeyName", zkKeyName))
+	keys.ProvingKeys, err = LoadProvingKey(zkKeyName)
 	if err != nil {
 		panic("provingKey loading error")
 	}
-	fmt.Println("finish loading proving key...")
-	fmt.Println("begin loading verifying key...")
-	prover.VerifyingKeys, err = LoadVerifyingKey(config.ZkKeyName)
+	logx.Infow("finish loading proving key", logx.Field("zkKeyName", zkKeyName))
+	logx.Infow("begin loading verifying key", logx.Field("zkKeyName", zkKeyName))
+	keys.VerifyingKeys, err = LoadVerifyingKey(zkKeyName)
 	if err != nil {
 		panic("verifyingKey loading error")
 	}
-	fmt.Println("finish loading verifying key...")
-	return &prover
+	logx.Infow("finish loading verifying key", logx.Field("zkKeyName", zkKeyName))
+	// the loaded points take about the size of their uncompressed files, ProveRoll reads
+	// the A, B1, Z and K segments and reloads B2 for every proof
+	keys.MemoryBytes = fileSizes(zkKeyName, ".ccs.save", ".ccs.ct.save", ".pk.E.save", ".pk.B2.save", ".vk.save")
+	keys.ProofMemoryBytes = int64(keys.R1cs.GetNbConstraints())*utils.ProofMemoryBytesPerConstraint +
+		fileSizes(zkKeyName, ".pk.A.save", ".pk.B1.save", ".pk.Z.save", ".pk.K.save", ".pk.B2.save")
+	return keys
 }
 
-func (p *Prover) Run(flag bool) {
-	p.proofModel.CreateProofTable()
-	batchWitnessFetch := func() (*witness.BatchWitness, error) {
-		lock := utils.GetRedisLockByKey(p.redisConn, utils.RedisLockKey)
-		err := utils.TryAcquireLock(lock)
-		if err != nil {
-			return nil, utils.GetRedisLockFailed
+// fileSizes returns the total size of the files named zkKeyName with suffixes, the
+// missing ones are skipped.
+func fileSizes(zkKeyName string, suffixes ...string) int64 {
+	var size int64
+	for _, suffix := range suffixes {
+		info, err := os.Stat(zkKeyName + suffix)
+		if err == nil {
+			size += info.Size()
 		}
-		defer lock.Release()
+	}
+	return size
+}
 
+// isBatchWitnessDone reports whether the witness service completed and every witness is
+// finished or failed, so a daemon prover has nothing left to wait for.
+func (p *Prover) isBatchWitnessDone() (bool, error) {
+	completed, err := p.witnessModel.IsBatchWitnessCompleted()
+	if err != nil || !completed {
+		return false, err
+	}
+	counts, err := p.witnessModel.GetRowCounts()
+	if err != nil {
+		return false, err
+	}
+	// published and received witnesses, the latter may be claimed again when their lease expires
+	return counts[1]+counts[2] == 0, nil
+}
+
+// Run proves the published batch witnesses and the received ones whose lease expired, or
+// only the latter if flag is set, by p.workers concurrent workers. Unless daemon is set a
+// worker returns when there is no such witness, a daemon worker polls for the witnesses
+// written meanwhile and returns when the witness service completed and all witnesses are
+// proven. When ctx is cancelled the proofs in progress are abandoned and their witnesses
+// are published again.
+func (p *Prover) Run(ctx context.Context, flag bool, daemon bool) {
+	p.proofModel.CreateProofTable()
+	if daemon {
+		// the prover may start before the witness service created the tables
+		p.witnessModel.CreateBatchWitnessTable()
+		p.witnessModel.CreateCheckpointTable()
+	}
+	if p.metricsEnabled {
+		go witness.ReportQueueDepth(ctx, p.witnessModel, 10*time.Second)
+	}
+	batchWitnessFetch := func() (*witness.BatchWitness, error) {
 		// Fetch unproved block witness.
-		blockWitness, err := p.witnessModel.GetLatestBatchWitnessByStatus(witness.StatusPublished)
+		var blockWitness *witness.BatchWitness
+		var err error
+		if !flag {
+			blockWitness, err = p.witnessModel.GetClaimableBatchWitness(time.Now().Unix())
+		} else {
+			blockWitness, err = p.witnessModel.GetExpiredBatchWitness(time.Now().Unix())
+		}
 		if err != nil {
 			return nil, err
 		}
-		// Update status of block witness.
-		err = p.witnessModel.UpdateBatchWitnessStatus(blockWitness, witness.StatusReceived)
+		// Lease block witness to this prover, which fails if another prover claimed it
+		// since it was fetched.
+		err = p.witnessModel.ClaimBatchWitness(blockWitness, p.owner, leaseExpiry())
 		if err != nil {
 			return nil, err
 		}
 		return blockWitness, nil
 	}
 
-	batchWitnessFetchForRerun := func() (*witness.BatchWitness, error) {
-		blockWitness, err := p.witnessModel.GetLatestBatchWitnessByStatus(witness.StatusReceived)
-		if err != nil {
-			return nil, err
-		}
-		return blockWitness, nil
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.runWorker(ctx, flag, daemon, batchWitnessFetch)
+		}()
 	}
+	wg.Wait()
+}
+
+// proofResult is the outcome of the proof of a batch, passed back by the proving goroutine.
+type proofResult struct {
+	proof groth16.Proof
+	err   error
+}
+
+// runWorker claims and proves one batch witness after the other, see Run.
+func (p *Prover) runWorker(ctx context.Context, flag bool, daemon bool, batchWitnessFetch func() (*witness.BatchWitness, error)) {
+	backoff := daemonMinBackoff
 	for {
-		var batchWitness *witness.BatchWitness
-		var err error
-		if !flag {
-			batchWitness, err = batchWitnessFetch()
-			if errors.Is(err, utils.GetRedisLockFailed) {
-				fmt.Println("get redis lock failed")
-				continue
-			}
-			if errors.Is(err, utils.DbErrNotFound) {
-				fmt.Println("there is no published status witness in db, so quit")
-				fmt.Println("prover run finish...")
-				return
-			}
+		if ctx.Err() != nil {
+			logx.Info("prover is cancelled")
+			return
+		}
+		batchWitness, err := batchWitnessFetch()
+		if errors.Is(err, utils.BatchWitnessClaimed) {
+			continue
+		}
+		if errors.Is(err, utils.DbErrNotFound) && daemon {
+			done, err := p.isBatchWitnessDone()
 			if err != nil {
-				fmt.Println("get batch witness failed: ", err.Error())
+				logx.Errorw("get witness status failed", logx.Field("error", err.Error()))
 				return
 			}
-		} else {
-			batchWitness, err = batchWitnessFetchForRerun()
-			if errors.Is(err, utils.DbErrNotFound) {
-				fmt.Println("there is no received status witness in db, so quit")
-				fmt.Println("prover rerun finish...")
+			if done {
+				logx.Info("witness service completed and all witnesses are proven, so quit")
+				logx.Info("prover daemon finish")
 				return
 			}
-			if err != nil {
-				fmt.Println("something wrong happened, err is ", err.Error())
-				return
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
 			}
+			backoff *= 2
+			if backoff > daemonMaxBackoff {
+				backoff = daemonMaxBackoff
+			}
+			continue
 		}
-
+		if errors.Is(err, utils.DbErrNotFound) {
+			if !flag {
+				logx.Info("there is no published status witness in db, so quit")
+				logx.Info("prover run finish")
+			} else {
+				logx.Info("there is no received status witness with expired lease in db, so quit")
+				logx.Info("prover rerun finish")
+			}
+			return
+		}
+		if err != nil {
+			logx.Errorw("get batch witness failed", logx.Field("error", err.Error()))
+			return
+		}
+		backoff = daemonMinBackoff
 		witnessForCircuit := utils.DecodeBatchWitness(batchWitness.WitnessData)
+		if witnessForCircuit == nil || len(witnessForCircuit.CreateUserOps) == 0 {
+			p.failBatchWitness(batchWitness, errors.New("decode invalid witness data"))
+			continue
+		}
 		cexAssetListCommitments := make([][]byte, 2)
 		cexAssetListCommitments[0] = witnessForCircuit.BeforeCEXAssetsCommitment
 		cexAssetListCommitments[1] = witnessForCircuit.AfterCEXAssetsCommitment
@@ -164,35 +384,66 @@ func (p *Prover) Run(flag bool) {
 		accountTreeRoots[1] = witnessForCircuit.AfterAccountTreeRoot
 		cexAssetListCommitmentsSerial, err := json.Marshal(cexAssetListCommitments)
 		if err != nil {
-			fmt.Println("marshal cex asset list failed: ", err.Error())
-			return
+			p.failBatchWitness(batchWitness, fmt.Errorf("marshal cex asset list failed: %w", err))
+			continue
 		}
 		accountTreeRootsSerial, err := json.Marshal(accountTreeRoots)
 		if err != nil {
-			fmt.Println("marshal account tree root failed: ", err.Error())
-			return
+			p.failBatchWitness(batchWitness, fmt.Errorf("marshal account tree root failed: %w", err))
+			continue
 		}
 
-		proof, err := GenerateAndVerifyProof(p.R1cs, p.ProvingKeys, p.VerifyingKeys, witnessForCircuit, p.SessionName, batchWitness.Height)
-		if err != nil {
-			fmt.Println("generate and verify proof error:", err.Error())
-		}
-		var buf bytes.Buffer
-		_, err = proof.WriteRawTo(&buf)
-		if err != nil {
-			fmt.Println("proof serialize failed")
-			return
+		// the heartbeat is stopped before the status of the witness is updated
+		stopHeartbeat := p.startHeartbeat(ctx, batchWitness.Height)
+		keys := p.acquireZkKeys(utils.GetZkKeyName(p.zkKeyName, len(witnessForCircuit.CreateUserOps),
+			len(witnessForCircuit.CreateUserOps[0].Assets)))
+		proofMemory := keys.ProofMemoryBytes
+		var result proofResult
+		cancelled := !p.admission.acquire(ctx, proofMemory)
+		if cancelled {
+			p.releaseZkKeys()
+		} else {
+			proofDone := make(chan proofResult, 1)
+			height := batchWitness.Height
+			go func() {
+				proof, err := GenerateAndVerifyProof(keys.R1cs, keys.ProvingKeys, keys.VerifyingKeys, witnessForCircuit, keys.Name, height)
+				proofDone <- proofResult{proof: proof, err: err}
+			}()
+			select {
+			case result = <-proofDone:
+				p.admission.release(proofMemory)
+				p.releaseZkKeys()
+			case <-ctx.Done():
+				cancelled = true
+				// the proof can't be interrupted, its memory and keys are released once it returns
+				go func() {
+					<-proofDone
+					p.admission.release(proofMemory)
+					p.releaseZkKeys()
+				}()
+			}
 		}
-		proofBytes := buf.Bytes()
-		_, err = p.proofModel.GetProofByBatchNumber(batchWitness.Height)
-		if err == nil {
-			fmt.Printf("blockProof of height %d exists\n", batchWitness.Height)
-			err = p.witnessModel.UpdateBatchWitnessStatus(batchWitness, witness.StatusFinished)
+		stopHeartbeat()
+		if cancelled {
+			// the witness is leased by this prover, so publish it again for the others
+			err = p.witnessModel.ReleaseBatchWitness(batchWitness, p.owner)
 			if err != nil {
-				fmt.Println("update witness error:", err.Error())
+				logx.Errorw("reset witness status error", logx.Field("height", batchWitness.Height), logx.Field("error", err.Error()))
 			}
+			logx.Infow("prover is cancelled, batch is published again", logx.Field("height", batchWitness.Height))
+			return
+		}
+		if result.err != nil {
+			p.failBatchWitness(batchWitness, fmt.Errorf("generate and verify proof error: %w", result.err))
+			continue
+		}
+		var buf bytes.Buffer
+		_, err = result.proof.WriteRawTo(&buf)
+		if err != nil {
+			p.failBatchWitness(batchWitness, fmt.Errorf("proof serialize failed: %w", err))
 			continue
 		}
+		proofBytes := buf.Bytes()
 
 		var row = &Proof{
 			ProofInfo:               base64.StdEncoding.EncodeToString(proofBytes),
@@ -200,16 +451,30 @@ func (p *Prover) Run(flag bool) {
 			CexAssetListCommitments: string(cexAssetListCommitmentsSerial),
 			AccountTreeRoots:        string(accountTreeRootsSerial),
 			BatchCommitment:         base64.StdEncoding.EncodeToString(witnessForCircuit.BatchCommitment),
+			ZkKeyName:               keys.Name,
 		}
-		err = p.proofModel.CreateProof(row)
-		if err != nil {
-			fmt.Printf("create blockProof of height %d failed\n", batchWitness.Height)
+		p.storeProof(batchWitness, row)
+	}
+}
+
+// storeProof stores the proof of batchWitness and finishes the witness. A proof of the batch
+// which another prover stored in the meantime is rejected by the unique batch number, the
+// witness is finished as well then. Any other error fails the attempt of this prover.
+func (p *Prover) storeProof(batchWitness *witness.BatchWitness, row *Proof) {
+	err := p.proofModel.CreateProof(row)
+	if err != nil {
+		_, getErr := p.proofModel.GetProofByBatchNumber(batchWitness.Height)
+		if getErr != nil {
+			p.failBatchWitness(batchWitness, fmt.Errorf("create blockProof failed: %w", err))
 			return
 		}
-		err = p.witnessModel.UpdateBatchWitnessStatus(batchWitness, witness.StatusFinished)
-		if err != nil {
-			fmt.Println("update witness error:", err.Error())
-		}
+		logx.Infow("blockProof exists", logx.Field("height", batchWitness.Height))
+	} else {
+		utils.ProverBatchesCounter.Inc()
+	}
+	err = p.witnessModel.UpdateBatchWitnessStatus(batchWitness, witness.StatusFinished)
+	if err != nil {
+		logx.Errorw("update witness error", logx.Field("height", batchWitness.Height), logx.Field("error", err.Error()))
 	}
 }
 
@@ -237,8 +502,11 @@ func GenerateAndVerifyProof(r1cs frontend.CompiledConstraintSystem,
 	batchNumber int64,
 ) (proof groth16.Proof, err error) {
 	startTime := time.Now().UnixMilli()
-	fmt.Println("begin to generate proof for batch: ", batchNumber)
-	circuitWitness, _ := circuit.SetBatchCreateUserCircuitWitness(batchWitness)
+	logx.Infow("begin to generate proof", logx.Field("batchNumber", batchNumber), logx.Field("zkKeyName", zkKeyName))
+	circuitWitness, err := circuit.SetBatchCreateUserCircuitWitness(batchWitness)
+	if err != nil {
+		return proof, err
+	}
 	verifyWitness := circuit.NewVerifyBatchCreateUserCircuit(batchWitness.BatchCommitment)
 	witness, err := frontend.NewWitness(circuitWitness, ecc.BN254)
 	if err != nil {
@@ -249,18 +517,40 @@ func GenerateAndVerifyProof(r1cs frontend.CompiledConstraintSystem,
 	if err != nil {
 		return proof, err
 	}
-	proof, err = groth16.ProveRoll(r1cs, provingKey[0], provingKey[1], witness, zkKeyName)
+	proof, err = proveRoll(r1cs, provingKey, witness, zkKeyName)
 	if err != nil {
 		return proof, err
 	}
 	endTime := time.Now().UnixMilli()
-	fmt.Println("proof generation cost ", endTime-startTime, " ms")
+	logx.Infow("proof generation finished", logx.Field("batchNumber", batchNumber), logx.Field("costMs", endTime-startTime))
+	utils.ProverProofHistogram.Observe(float64(endTime-startTime) / 1000)
 
 	err = groth16.Verify(proof, verifyingKey, vWitness)
 	if err != nil {
 		return proof, err
 	}
 	endTime2 := time.Now().UnixMilli()
-	fmt.Println("proof verification cost ", endTime2-endTime, " ms")
+	logx.Infow("proof verification finished", logx.Field("batchNumber", batchNumber), logx.Field("costMs", endTime2-endTime))
+	utils.ProverVerifyHistogram.Observe(float64(endTime2-endTime) / 1000)
 	return proof, nil
 }
+
+// proveRoll proves witness with the segmented proving keys of zkKeyName, which may be
+// shared by concurrent proofs. ProveRoll of the bnb-chain gnark fork drops the G2.B points
+// of its pkB2 argument after the Bs2 multi exp and reads them again from the .pk.B2.save
+// file, so every proof gets a shallow copy of pkB2 whose G2.B it replaces, while the
+// points of the shared key are only read.
+func proveRoll(r1cs frontend.CompiledConstraintSystem, provingKey []groth16.ProvingKey, fullWitness *backendWitness.Witness, zkKeyName string) (groth16.Proof, error) {
+	return groth16.ProveRoll(r1cs, provingKey[0], cloneProvingKey(provingKey[1]), fullWitness, zkKeyName)
+}
+
+// cloneProvingKey returns a shallow copy of pk, the concrete key types of gnark are internal.
+// It relies on github.com/bnb-chain/gnark v0.7.1-0.20230203031713-0d81c67d080a, whose
+// ProveRoll only assigns pkB2.G2.B and reads the other fields of pkB2, and which reads
+// pkE only. TestConcurrentProveRoll has to pass again when the fork is upgraded.
+func cloneProvingKey(pk groth16.ProvingKey) groth16.ProvingKey {
+	v := reflect.ValueOf(pk).Elem()
+	clone := reflect.New(v.Type())
+	clone.Elem().Set(v)
+	return clone.Interface().(groth16.ProvingKey)
+}
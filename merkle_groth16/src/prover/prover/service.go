@@ -0,0 +1,25 @@
+package prover
+
+import (
+	"context"
+	"errors"
+
+	"merkleverifytool/merkle_groth16/src/prover/config"
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+// ValidateRunFlags checks the run modes of the prover, a daemon prover claims the witnesses
+// with an expired lease too, so it can't be combined with rerun.
+func ValidateRunFlags(rerun bool, daemon bool) error {
+	if rerun && daemon {
+		return errors.New("daemon can't be combined with rerun, a daemon prover claims expired witnesses too")
+	}
+	return nil
+}
+
+// RunService proves the batch witnesses with the keys of proverConfig, see Prover.Run.
+func RunService(ctx context.Context, proverConfig *config.Config, rerun bool, daemon bool) {
+	utils.StartMetricsServer(proverConfig.MetricsAddr)
+	prover := NewProver(proverConfig)
+	prover.Run(ctx, rerun, daemon)
+}
@@ -0,0 +1,75 @@
+package prover
+
+import (
+	"path/filepath"
+	"testing"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/witness/witness"
+)
+
+func TestStoreProof(t *testing.T) {
+	db, err := utils.OpenDB(utils.DbDriverSqlite, filepath.Join(t.TempDir(), "por.db"), utils.LogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	witnessModel := witness.NewWitnessModel(db, "")
+	if err = witnessModel.CreateBatchWitnessTable(); err != nil {
+		t.Fatal(err)
+	}
+	err = witnessModel.CreateBatchWitness([]witness.BatchWitness{
+		{Height: 0, WitnessData: "w0", Status: witness.StatusPublished},
+		{Height: 1, WitnessData: "w1", Status: witness.StatusPublished},
+		{Height: 2, WitnessData: "w2", Status: witness.StatusPublished},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofModel := NewProofModel(db, "")
+	if err = proofModel.CreateProofTable(); err != nil {
+		t.Fatal(err)
+	}
+	p := &Prover{witnessModel: witnessModel, proofModel: proofModel, owner: "a", maxAttempts: 2}
+	claim := func(height int64) *witness.BatchWitness {
+		batchWitness, err := witnessModel.GetBatchWitnessByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = witnessModel.ClaimBatchWitness(batchWitness, p.owner, leaseExpiry()); err != nil {
+			t.Fatal(err)
+		}
+		return batchWitness
+	}
+	status := func(height int64) *witness.BatchWitness {
+		batchWitness, err := witnessModel.GetBatchWitnessByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return batchWitness
+	}
+
+	p.storeProof(claim(0), &Proof{BatchNumber: 0, ProofInfo: "a"})
+	if w := status(0); w.Status != witness.StatusFinished {
+		t.Fatalf("stored batch is not finished: %+v", w)
+	}
+
+	// the proof of another prover is kept and the batch is finished without a failed attempt
+	if err = proofModel.CreateProof(&Proof{BatchNumber: 1, ProofInfo: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	p.storeProof(claim(1), &Proof{BatchNumber: 1, ProofInfo: "a"})
+	if w := status(1); w.Status != witness.StatusFinished || w.Attempts != 0 {
+		t.Fatalf("batch with an existing proof is not finished: %+v", w)
+	}
+	proof, err := proofModel.GetProofByBatchNumber(1)
+	if err != nil || proof.ProofInfo != "b" {
+		t.Fatalf("existing proof %+v, %v", proof, err)
+	}
+
+	// the batch is published again if the proof can't be stored
+	p.proofModel = NewProofModel(db, "_missing")
+	p.storeProof(claim(2), &Proof{BatchNumber: 2})
+	if w := status(2); w.Status != witness.StatusPublished || w.Attempts != 1 {
+		t.Fatalf("batch whose proof isn't stored is not failed: %+v", w)
+	}
+}
@@ -0,0 +1,122 @@
+package prover
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"time"
+
+	"merkleverifytool/merkle_groth16/circuit"
+	"merkleverifytool/merkle_groth16/src/prover/config"
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/witness/witness"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// CexSummaryProof is the proof of the cex summary circuit together with its public inputs.
+type CexSummaryProof struct {
+	ProofInfo       string
+	BatchNumber     int64
+	BatchCommitment string
+	AccountTreeRoot string
+	TotalEquity     uint64
+	TotalDebt       uint64
+	CexAssetsInfo   []utils.CexAssetInfo
+}
+
+// NewVerifyCexSummaryCircuit builds the public witness of p.
+func (p *CexSummaryProof) NewVerifyCexSummaryCircuit() (*circuit.CexSummaryCircuit, error) {
+	batchCommitment, err := base64.StdEncoding.DecodeString(p.BatchCommitment)
+	if err != nil {
+		return nil, err
+	}
+	accountTreeRoot, err := base64.StdEncoding.DecodeString(p.AccountTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+	return circuit.NewVerifyCexSummaryCircuit(batchCommitment, accountTreeRoot, p.TotalEquity, p.TotalDebt, p.CexAssetsInfo), nil
+}
+
+// RunCexSummary proves the cex state after the latest batch witness and writes the proof
+// to config.SummaryProofFile.
+func RunCexSummary(config *config.Config) {
+	db, err := utils.OpenDB(config.DbDriver, config.MysqlDataSource, config.Log)
+	if err != nil {
+		panic(err.Error())
+	}
+	witnessModel := witness.NewWitnessModel(db, config.DbSuffix)
+	latestWitness, err := witnessModel.GetLatestBatchWitness()
+	if err != nil {
+		panic(err.Error())
+	}
+	batchWitness := utils.DecodeBatchWitness(latestWitness.WitnessData)
+	if batchWitness == nil {
+		panic("decode invalid witness data")
+	}
+
+	std.RegisterHints()
+	r1cs, err := groth16.LoadR1CSFromFile(config.SummaryZkKeyName)
+	if err != nil {
+		panic("r1cs init error")
+	}
+	provingKeys, err := LoadProvingKey(config.SummaryZkKeyName)
+	if err != nil {
+		panic("provingKey loading error")
+	}
+	verifyingKey, err := LoadVerifyingKey(config.SummaryZkKeyName)
+	if err != nil {
+		panic("verifyingKey loading error")
+	}
+
+	startTime := time.Now().UnixMilli()
+	logx.Infow("begin to generate cex summary proof", logx.Field("height", latestWitness.Height))
+	circuitWitness, _ := circuit.SetCexSummaryCircuitWitness(batchWitness)
+	fullWitness, err := frontend.NewWitness(circuitWitness, ecc.BN254)
+	if err != nil {
+		panic(err.Error())
+	}
+	publicWitness, err := frontend.NewWitness(circuitWitness, ecc.BN254, frontend.PublicOnly())
+	if err != nil {
+		panic(err.Error())
+	}
+	proof, err := groth16.ProveRoll(r1cs, provingKeys[0], provingKeys[1], fullWitness, config.SummaryZkKeyName)
+	if err != nil {
+		panic(err.Error())
+	}
+	err = groth16.Verify(proof, verifyingKey, publicWitness)
+	if err != nil {
+		panic(err.Error())
+	}
+	endTime := time.Now().UnixMilli()
+	logx.Infow("cex summary proof generation finished", logx.Field("height", latestWitness.Height), logx.Field("costMs", endTime-startTime))
+
+	var buf bytes.Buffer
+	_, err = proof.WriteRawTo(&buf)
+	if err != nil {
+		panic(err.Error())
+	}
+	summaryProof := CexSummaryProof{
+		ProofInfo:       base64.StdEncoding.EncodeToString(buf.Bytes()),
+		BatchNumber:     latestWitness.Height,
+		BatchCommitment: base64.StdEncoding.EncodeToString(batchWitness.BatchCommitment),
+		AccountTreeRoot: base64.StdEncoding.EncodeToString(batchWitness.AfterAccountTreeRoot),
+		TotalEquity:     batchWitness.TotalCexAssets.AfterCEXTotalEquity,
+		TotalDebt:       batchWitness.TotalCexAssets.AfterCEXTotalDebt,
+		CexAssetsInfo:   utils.RecoverAfterCexAssets(batchWitness),
+	}
+	content, err := json.MarshalIndent(summaryProof, "", "  ")
+	if err != nil {
+		panic(err.Error())
+	}
+	err = ioutil.WriteFile(config.SummaryProofFile, content, 0644)
+	if err != nil {
+		panic(err.Error())
+	}
+	logx.Infow("cex summary proof is written", logx.Field("file", config.SummaryProofFile))
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+type Config struct {
+	UserConfigFile string // the user_config.json of the user proof, it is only read by the prover
+	ZkKeyName      string // key base name of the user inclusion circuits, see utils.GetUserInclusionZkKeyName
+	ProofFile      string
+	Claims         []utils.UserAssetClaim
+	// sha256 of the .vk.save files published by the exchange by key base name, -verify
+	// fails for a key which is not listed here
+	VerifyingKeyHashes map[string]string
+	Log                utils.LogConfig
+}
+
+func (c *Config) SetDefaults() {
+	c.Log.SetDefaults()
+	c.ZkKeyName = utils.UserInclusionZkKeyName
+	c.ProofFile = "user_inclusion_proof.json"
+}
+
+func (c *Config) Validate() error {
+	if c.ZkKeyName == "" {
+		return errors.New("ZkKeyName is empty")
+	}
+	if c.ProofFile == "" {
+		return errors.New("ProofFile is empty")
+	}
+	if len(c.Claims) > utils.UserInclusionClaimCounts {
+		return fmt.Errorf("%d Claims exceed %d", len(c.Claims), utils.UserInclusionClaimCounts)
+	}
+	for _, claim := range c.Claims {
+		if int(claim.Index) >= utils.AssetCounts {
+			return fmt.Errorf("claimed asset %d is out of %d assets", claim.Index, utils.AssetCounts)
+		}
+	}
+	return c.Log.Validate()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"merkleverifytool/merkle_groth16/src/conf"
+	"merkleverifytool/merkle_groth16/src/userinclusion/config"
+	"merkleverifytool/merkle_groth16/src/userinclusion/userinclusion"
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/verifier/verifier"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+func main() {
+	verifyFlag := flag.Bool("verify", false, "flag which indicates user inclusion proof verification")
+	configFlag := flag.String("config", "src/userinclusion/config/config.json", "config file of the user inclusion proof")
+	flag.Parse()
+	defer utils.LogPanic()
+	userInclusionConfig := &config.Config{}
+	conf.MustLoad(*configFlag, userInclusionConfig)
+	utils.SetupLogger("userinclusion", userInclusionConfig.Log)
+	if *verifyFlag {
+		userInclusionProof, err := userinclusion.Verify(userInclusionConfig)
+		if err != nil {
+			fmt.Println("user inclusion proof verify failed:", err.Error())
+			logx.Close()
+			os.Exit(verifier.VerifyExitCode(err))
+		}
+		fmt.Println(userInclusionProof)
+		fmt.Println("user inclusion proof verify passed!!!")
+		return
+	}
+	err := userinclusion.Prove(userInclusionConfig)
+	if err != nil {
+		panic(err.Error())
+	}
+}
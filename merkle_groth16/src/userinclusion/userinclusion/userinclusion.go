@@ -0,0 +1,245 @@
+package userinclusion
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"merkleverifytool/merkle_groth16/circuit"
+	"merkleverifytool/merkle_groth16/src/bundle"
+	"merkleverifytool/merkle_groth16/src/conf"
+	"merkleverifytool/merkle_groth16/src/prover/prover"
+	"merkleverifytool/merkle_groth16/src/userinclusion/config"
+	"merkleverifytool/merkle_groth16/src/utils"
+	verifierConfig "merkleverifytool/merkle_groth16/src/verifier/config"
+	"merkleverifytool/merkle_groth16/src/verifier/verifier"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// UserInclusionProof is the proof of the user inclusion circuit together with its public
+// inputs, it can be shared without the user proof.
+type UserInclusionProof struct {
+	ProofInfo       string
+	AccountTreeRoot string
+	AccountIdHash   string
+	UserAssetCounts int
+	Claims          []utils.UserAssetClaim
+}
+
+func (p *UserInclusionProof) NewVerifyUserInclusionCircuit() (*circuit.UserInclusionCircuit, error) {
+	accountTreeRoot, err := hex.DecodeString(p.AccountTreeRoot)
+	if err != nil || len(accountTreeRoot) != 32 {
+		return nil, fmt.Errorf("invalid account tree root")
+	}
+	accountIdHash, err := hex.DecodeString(p.AccountIdHash)
+	if err != nil || len(accountIdHash) != 32 {
+		return nil, fmt.Errorf("invalid account id hash")
+	}
+	if len(p.Claims) > utils.UserInclusionClaimCounts {
+		return nil, fmt.Errorf("%d claims exceed %d", len(p.Claims), utils.UserInclusionClaimCounts)
+	}
+	return circuit.NewVerifyUserInclusionCircuit(accountTreeRoot, accountIdHash, utils.PaddingUserAssetClaims(p.Claims)), nil
+}
+
+// String is the verified statement of the proof, the root has to be compared with the
+// published account tree root.
+func (p *UserInclusionProof) String() string {
+	lines := []string{
+		"account tree root: " + p.AccountTreeRoot,
+		"account id hash: " + p.AccountIdHash,
+	}
+	for _, claim := range p.Claims {
+		if claim.MinBalance == math.MinInt64 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("the balance of asset %d is at least %d", claim.Index, claim.MinBalance))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkUserConfig checks that the leaf of userConfig is in its account tree, that its asset
+// slots are a tier of the user inclusion circuits and that the claims hold, which the
+// circuit can't solve otherwise.
+func checkUserConfig(userConfig *verifierConfig.UserConfig, claims []utils.UserAssetClaim) error {
+	isUserAssetCounts := false
+	for _, counts := range utils.UserAssetCountsTiers {
+		isUserAssetCounts = isUserAssetCounts || counts == len(userConfig.Assets)
+	}
+	if !isUserAssetCounts {
+		return fmt.Errorf("%d asset slots are none of the tiers %v", len(userConfig.Assets), utils.UserAssetCountsTiers)
+	}
+	err := verifier.VerifyUser(userConfig)
+	if err != nil {
+		return err
+	}
+	for _, claim := range claims {
+		balance := int64(0)
+		for _, asset := range userConfig.Assets {
+			if asset.Index == claim.Index {
+				balance = asset.Balance
+			}
+		}
+		if balance < claim.MinBalance {
+			return fmt.Errorf("the balance %d of asset %d is below the claimed %d", balance, claim.Index, claim.MinBalance)
+		}
+	}
+	return nil
+}
+
+// Prove proves the claims of userInclusionConfig for the user proof of its UserConfigFile
+// and writes the proof to ProofFile.
+func Prove(userInclusionConfig *config.Config) error {
+	if userInclusionConfig.UserConfigFile == "" {
+		return errors.New("UserConfigFile is empty")
+	}
+	userConfig := &verifierConfig.UserConfig{}
+	err := conf.Load(userInclusionConfig.UserConfigFile, userConfig)
+	if err != nil {
+		return err
+	}
+	root, err := hex.DecodeString(userConfig.Root)
+	if err != nil || len(root) != 32 {
+		return errors.New("invalid account tree root")
+	}
+	accountIdHash, err := hex.DecodeString(userConfig.AccountIdHash)
+	if err != nil || len(accountIdHash) != 32 {
+		return errors.New("the AccountIdHash is invalid")
+	}
+	var accountProof [][]byte
+	for i := 0; i < len(userConfig.Proof); i++ {
+		p, err := base64.StdEncoding.DecodeString(userConfig.Proof[i])
+		if err != nil || len(p) != 32 {
+			return errors.New("invalid proof")
+		}
+		accountProof = append(accountProof, p)
+	}
+	err = checkUserConfig(userConfig, userInclusionConfig.Claims)
+	if err != nil {
+		return fmt.Errorf("invalid user config %s: %w", userInclusionConfig.UserConfigFile, err)
+	}
+
+	zkKeyName := utils.GetUserInclusionZkKeyName(userInclusionConfig.ZkKeyName, len(userConfig.Assets))
+	std.RegisterHints()
+	r1cs, err := groth16.LoadR1CSFromFile(zkKeyName)
+	if err != nil {
+		return fmt.Errorf("load r1cs %s failed: %w", zkKeyName, err)
+	}
+	provingKeys, err := prover.LoadProvingKey(zkKeyName)
+	if err != nil {
+		return fmt.Errorf("load proving key %s failed: %w", zkKeyName, err)
+	}
+
+	startTime := time.Now().UnixMilli()
+	circuitWitness, err := circuit.SetUserInclusionCircuitWitness(root, userConfig.AccountIndex, accountIdHash,
+		&userConfig.TotalEquity, &userConfig.TotalDebt, userConfig.Assets, accountProof,
+		utils.PaddingUserAssetClaims(userInclusionConfig.Claims))
+	if err != nil {
+		return fmt.Errorf("invalid user config %s: %w", userInclusionConfig.UserConfigFile, err)
+	}
+	witness, err := frontend.NewWitness(circuitWitness, ecc.BN254)
+	if err != nil {
+		return err
+	}
+	proof, err := groth16.ProveRoll(r1cs, provingKeys[0], provingKeys[1], witness, zkKeyName)
+	if err != nil {
+		return err
+	}
+	endTime := time.Now().UnixMilli()
+	logx.Infow("user inclusion proof generated", logx.Field("costMs", endTime-startTime))
+
+	var buf bytes.Buffer
+	_, err = proof.WriteRawTo(&buf)
+	if err != nil {
+		return err
+	}
+	userInclusionProof := UserInclusionProof{
+		ProofInfo:       base64.StdEncoding.EncodeToString(buf.Bytes()),
+		AccountTreeRoot: userConfig.Root,
+		AccountIdHash:   userConfig.AccountIdHash,
+		UserAssetCounts: len(userConfig.Assets),
+		Claims:          userInclusionConfig.Claims,
+	}
+	content, err := json.MarshalIndent(userInclusionProof, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(userInclusionConfig.ProofFile, content, 0644)
+	if err != nil {
+		return err
+	}
+	logx.Infow("user inclusion proof written", logx.Field("file", userInclusionConfig.ProofFile))
+	return nil
+}
+
+// Verify checks ProofFile with the verifying key of its tier, the key has to match the
+// sha256 published by the exchange in VerifyingKeyHashes. The error wraps
+// verifier.ErrInvalid if the key doesn't match or the proof doesn't verify.
+func Verify(userInclusionConfig *config.Config) (*UserInclusionProof, error) {
+	content, err := ioutil.ReadFile(userInclusionConfig.ProofFile)
+	if err != nil {
+		return nil, err
+	}
+	userInclusionProof := &UserInclusionProof{}
+	err = json.Unmarshal(content, userInclusionProof)
+	if err != nil {
+		return nil, fmt.Errorf("decode user inclusion proof %s failed: %w", userInclusionConfig.ProofFile, err)
+	}
+	isUserAssetCounts := false
+	for _, counts := range utils.UserAssetCountsTiers {
+		isUserAssetCounts = isUserAssetCounts || counts == userInclusionProof.UserAssetCounts
+	}
+	if !isUserAssetCounts {
+		return nil, fmt.Errorf("invalid user asset counts %d", userInclusionProof.UserAssetCounts)
+	}
+	zkKeyName := utils.GetUserInclusionZkKeyName(userInclusionConfig.ZkKeyName, userInclusionProof.UserAssetCounts)
+	hash, ok := userInclusionConfig.VerifyingKeyHashes[filepath.Base(zkKeyName)]
+	if !ok {
+		return nil, fmt.Errorf("the hash of verifying key %s is not pinned in VerifyingKeyHashes", filepath.Base(zkKeyName))
+	}
+	actual, err := bundle.HashVerifyingKey(zkKeyName)
+	if err != nil {
+		return nil, err
+	}
+	if actual != hash {
+		return nil, fmt.Errorf("%w: verifying key %s doesn't match the published hash", verifier.ErrInvalid, zkKeyName)
+	}
+	vk, err := prover.LoadVerifyingKey(zkKeyName)
+	if err != nil {
+		return nil, err
+	}
+	proof := groth16.NewProof(ecc.BN254)
+	proofRaw, err := base64.StdEncoding.DecodeString(userInclusionProof.ProofInfo)
+	if err != nil {
+		return nil, fmt.Errorf("decode user inclusion proof failed: %w", err)
+	}
+	_, err = proof.ReadFrom(bytes.NewReader(proofRaw))
+	if err != nil {
+		return nil, fmt.Errorf("decode user inclusion proof failed: %w", err)
+	}
+	verifyWitness, err := userInclusionProof.NewVerifyUserInclusionCircuit()
+	if err != nil {
+		return nil, err
+	}
+	vWitness, err := frontend.NewWitness(verifyWitness, ecc.BN254, frontend.PublicOnly())
+	if err != nil {
+		return nil, err
+	}
+	err = groth16.Verify(proof, vk, vWitness)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user inclusion proof: %s", verifier.ErrInvalid, err.Error())
+	}
+	return userInclusionProof, nil
+}
@@ -1,13 +1,41 @@
 package config
 
+import (
+	"errors"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
 type Config struct {
-	MysqlDataSource string
+	DbDriver        string // mysql, postgres or sqlite, mysql if empty
+	MysqlDataSource string // dsn of DbDriver
 	UserDataFile    string
+	AssetPriceFile  string
 	DbSuffix        string
-	TreeDB          struct {
-		Driver string
-		Option struct {
-			Addr string
-		}
+	MetricsAddr     string // address of the prometheus metrics endpoint, disabled if empty
+	Log             utils.LogConfig
+	TreeDB          utils.TreeDBConfig
+}
+
+func (c *Config) SetDefaults() {
+	c.Log.SetDefaults()
+}
+
+func (c *Config) Validate() error {
+	if err := utils.ValidateDbDriver(c.DbDriver); err != nil {
+		return err
+	}
+	if c.MysqlDataSource == "" {
+		return errors.New("MysqlDataSource is empty")
+	}
+	if c.UserDataFile == "" {
+		return errors.New("UserDataFile is empty")
+	}
+	if c.AssetPriceFile == "" {
+		return errors.New("AssetPriceFile is empty")
+	}
+	if err := c.TreeDB.Validate(); err != nil {
+		return err
 	}
+	return c.Log.Validate()
 }
@@ -25,8 +25,8 @@ type (
 	}
 
 	UserProof struct {
-		AccountIndex    uint32 `gorm:"index:idx_int,unique"`
-		AccountId       string `gorm:"index:idx_str,unique"`
+		AccountIndex    uint32 `gorm:"index:,unique"`
+		AccountId       string `gorm:"index:,unique"`
 		AccountLeafHash string
 		TotalEquity     string
 		TotalDebt       string
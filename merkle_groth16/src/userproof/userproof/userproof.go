@@ -0,0 +1,276 @@
+package userproof
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"merkleverifytool/merkle_groth16/src/userproof/config"
+	"merkleverifytool/merkle_groth16/src/userproof/model"
+	"merkleverifytool/merkle_groth16/src/utils"
+	"time"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/poseidon"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+func HandleUserData(userProofConfig *config.Config) []utils.AccountInfo {
+	startTime := time.Now().UnixMilli()
+	accounts, cexAssetsInfo, err := utils.ParseUserDataSet(userProofConfig.UserDataFile)
+	if err != nil {
+		panic(err.Error())
+	}
+	accounts, err = utils.ApplyAssetPrices(accounts, cexAssetsInfo, userProofConfig.AssetPriceFile)
+	if err != nil {
+		panic(err.Error())
+	}
+	// the same order and asset slots as the witness service
+	accounts = utils.ArrangeAccountsByUserAssetCounts(accounts)
+
+	endTime := time.Now().UnixMilli()
+	logx.Infow("handle user data finished", logx.Field("accounts", len(accounts)), logx.Field("costMs", endTime-startTime))
+	return accounts
+}
+
+type AccountLeave struct {
+	hash  []byte
+	index uint32
+}
+
+func ComputeAccountRootHash(userProofConfig *config.Config) {
+	accountTree, err := utils.NewAccountTree("memory", "")
+	if err != nil {
+		panic(err.Error())
+	}
+	logx.Infow("account tree init", logx.Field("accountTreeRoot", hex.EncodeToString(accountTree.Root())))
+	accounts, cexAssetsInfo, err := utils.ParseUserDataSet(userProofConfig.UserDataFile)
+	if err != nil {
+		panic(err.Error())
+	}
+	accounts, err = utils.ApplyAssetPrices(accounts, cexAssetsInfo, userProofConfig.AssetPriceFile)
+	if err != nil {
+		panic(err.Error())
+	}
+	// the same order and asset slots as the witness service
+	accounts = utils.ArrangeAccountsByUserAssetCounts(accounts)
+	startTime := time.Now().UnixMilli()
+	totalOpsNumber := len(accounts)
+	logx.Infow("total ops number", logx.Field("accounts", totalOpsNumber))
+	chs := make(chan AccountLeave, 1000)
+	workers := 32
+	results := make(chan bool, workers)
+	averageAccounts := (totalOpsNumber + workers - 1) / workers
+	actualWorkers := 0
+	for i := 0; i < workers; i++ {
+		srcAccountIndex := i * averageAccounts
+		destAccountIndex := (i + 1) * averageAccounts
+		if destAccountIndex > totalOpsNumber {
+			destAccountIndex = totalOpsNumber
+		}
+		go CalculateAccountHash(accounts[srcAccountIndex:destAccountIndex], chs, results)
+		if destAccountIndex == totalOpsNumber {
+			actualWorkers = i + 1
+			break
+		}
+	}
+	logx.Infow("actual workers", logx.Field("workers", actualWorkers))
+	quit := make(chan bool, 1)
+	go CalculateAccountTreeRoot(chs, &accountTree, quit)
+
+	for i := 0; i < actualWorkers; i++ {
+		<-results
+	}
+	close(chs)
+	<-quit
+	endTime := time.Now().UnixMilli()
+	logx.Infow("user account tree generation finished", logx.Field("costMs", endTime-startTime),
+		logx.Field("accountTreeRoot", hex.EncodeToString(accountTree.Root())))
+
+}
+
+func CalculateAccountHash(accounts []utils.AccountInfo, chs chan<- AccountLeave, res chan<- bool) {
+	poseidonHasher := poseidon.NewPoseidon()
+	for i := 0; i < len(accounts); i++ {
+		chs <- AccountLeave{
+			hash:  utils.AccountInfoToHash(&accounts[i], &poseidonHasher),
+			index: accounts[i].AccountIndex,
+		}
+	}
+	res <- true
+}
+
+func CalculateAccountTreeRoot(accountLeaves <-chan AccountLeave, accountTree *bsmt.SparseMerkleTree, quit chan<- bool) {
+	num := 0
+	for accountLeaf := range accountLeaves {
+		(*accountTree).Set(uint64(accountLeaf.index), accountLeaf.hash) //似乎在set的时候就已经计算了root,将哈希值和索引对应设置到整个哈希树中。
+		num++
+		if num%100000 == 0 {
+			logx.Infow("accounts set in tree", logx.Field("accounts", num), logx.Field("accountIndex", accountLeaf.index))
+		}
+	}
+	quit <- true
+}
+
+// RunService writes the proof of every user to the userproof table, continuing after the
+// latest written account, or only computes the account tree root in memory if memoryTree is
+// set. When ctx is cancelled the proofs computed so far are written.
+func RunService(ctx context.Context, userProofConfig *config.Config, memoryTree bool) {
+	utils.StartMetricsServer(userProofConfig.MetricsAddr)
+	if memoryTree {
+		ComputeAccountRootHash(userProofConfig)
+		return
+	}
+	accountTree, err := utils.NewAccountTree(userProofConfig.TreeDB.Driver, userProofConfig.TreeDB.Option.Addr)
+	accounts := HandleUserData(userProofConfig)
+	logx.Infow("accounts", logx.Field("accounts", len(accounts)))
+
+	userProofModel := OpenUserProofTable(userProofConfig)
+	latestAccountIndex, err := userProofModel.GetLatestAccountIndex()
+	if err != nil && err != utils.DbErrNotFound {
+		panic(err.Error())
+	}
+	if err == nil {
+		latestAccountIndex += 1
+	}
+
+	accountTreeRoot := hex.EncodeToString(accountTree.Root())
+	jobs := make(chan Job, 1000)
+	nums := make(chan int, 1)
+	results := make(chan *model.UserProof, 1000)
+	for i := 0; i < 1; i++ {
+		go worker(jobs, results, nums, accountTreeRoot)
+	}
+	quit := make(chan int, 1)
+	for i := 0; i < 1; i++ {
+		go WriteDB(results, userProofModel, quit, latestAccountIndex)
+	}
+	// when cancelled, the proofs of the accounts sent to the workers are still written to
+	// db, and the next run continues from the latest account index
+	for i := int(latestAccountIndex); i < len(accounts); i++ {
+		if ctx.Err() != nil {
+			logx.Infow("userproof service is cancelled", logx.Field("accountIndex", i))
+			break
+		}
+		leaf, err := accountTree.Get(uint64(i), nil)
+		if err != nil {
+			panic(err.Error())
+		}
+		proof, err := accountTree.GetProof(uint64(accounts[i].AccountIndex))
+		if err != nil {
+			panic(err.Error())
+		}
+		jobs <- Job{
+			account: &accounts[i],
+			proof:   proof,
+			leaf:    leaf,
+		}
+	}
+	close(jobs)
+	totalCounts := int(latestAccountIndex)
+	for i := 0; i < 1; i++ {
+		num := <-nums
+		totalCounts += num
+		logx.Infow("userproof workers finished", logx.Field("totalCounts", totalCounts))
+	}
+	if ctx.Err() == nil && totalCounts != len(accounts) {
+		logx.Errorw("userproof counts mismatch", logx.Field("totalCounts", totalCounts), logx.Field("accounts", len(accounts)))
+		panic("mismatch num")
+	}
+	close(results)
+	for i := 0; i < 1; i++ {
+		<-quit
+	}
+	if ctx.Err() != nil {
+		logx.Infow("userproof service is cancelled, the proofs are written", logx.Field("totalCounts", totalCounts))
+		return
+	}
+	logx.Info("userproof service run finished")
+}
+
+func WriteDB(results <-chan *model.UserProof, userProofModel model.UserProofModel, quit chan<- int, latestAccountIndex uint32) {
+	index := 0
+	proofs := make([]model.UserProof, 100)
+	num := int(latestAccountIndex)
+	for proof := range results {
+		proofs[index] = *proof
+		index += 1
+		if index%100 == 0 {
+			error := userProofModel.CreateUserProofs(proofs)
+			if error != nil {
+				panic(error.Error())
+			}
+			num += 100
+			utils.UserProofsCounter.Add(100)
+			if num%100000 == 0 {
+				logx.Infow("write proofs to db", logx.Field("totalCounts", num), logx.Field("accountIndex", proof.AccountIndex))
+			}
+			index = 0
+		}
+	}
+	proofs = proofs[:index]
+	if index > 0 {
+		logx.Infow("write proofs to db", logx.Field("counts", len(proofs)))
+		userProofModel.CreateUserProofs(proofs)
+		num += index
+		utils.UserProofsCounter.Add(float64(index))
+	}
+	logx.Infow("total write", logx.Field("totalCounts", num))
+	quit <- 0
+}
+
+type Job struct {
+	account *utils.AccountInfo
+	proof   [][]byte
+	leaf    []byte
+}
+
+func worker(jobs <-chan Job, results chan<- *model.UserProof, nums chan<- int, root string) {
+	num := 0
+	for job := range jobs {
+		userProof := ConvertAccount(job.account, job.leaf, job.proof, root)
+		results <- userProof
+		num += 1
+	}
+	nums <- num
+}
+
+func ConvertAccount(account *utils.AccountInfo, leafHash []byte, proof [][]byte, root string) *model.UserProof {
+	var userProof model.UserProof
+	var userConfig model.UserConfig
+	userProof.AccountIndex = account.AccountIndex
+	userProof.AccountId = hex.EncodeToString(account.AccountId)
+	userProof.AccountLeafHash = hex.EncodeToString(leafHash)
+	proofSerial, err := json.Marshal(proof)
+	userProof.Proof = string(proofSerial)
+	assets, err := json.Marshal(account.Assets)
+	if err != nil {
+		panic(err.Error())
+	}
+	userProof.Assets = string(assets)
+	userProof.TotalDebt = account.TotalDebt.String()
+	userProof.TotalEquity = account.TotalEquity.String()
+
+	userConfig.AccountIndex = account.AccountIndex
+	userConfig.AccountIdHash = hex.EncodeToString(account.AccountId)
+	userConfig.Proof = proof
+	userConfig.Root = root
+	userConfig.Assets = account.Assets
+	userConfig.TotalDebt = account.TotalDebt
+	userConfig.TotalEquity = account.TotalEquity
+	configSerial, err := json.Marshal(userConfig)
+	if err != nil {
+		panic(err.Error())
+	}
+	userProof.Config = string(configSerial)
+	return &userProof
+}
+
+func OpenUserProofTable(userConfig *config.Config) model.UserProofModel {
+	db, err := utils.OpenDB(userConfig.DbDriver, userConfig.MysqlDataSource, userConfig.Log)
+	if err != nil {
+		panic(err.Error())
+	}
+	userProofTable := model.NewUserProofModel(db, userConfig.DbSuffix)
+	userProofTable.CreateUserProofTable()
+	return userProofTable
+}
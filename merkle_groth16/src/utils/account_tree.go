@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"hash"
 	"time"
 
@@ -13,20 +15,59 @@ import (
 )
 
 var (
-	NilAccountHash []byte
+	// NilAccountHash is the leaf of an account without balances and EmptyAccountTreeRoot
+	// the root of the account tree without accounts, both depend on AssetCounts and
+	// AccountTreeDepth
+	NilAccountHash       []byte
+	EmptyAccountTreeRoot []byte
 )
 
+// TreeDBConfig is the "TreeDB" section of the service configs, the db of the account tree.
+type TreeDBConfig struct {
+	Driver string // memory or redis
+	Option struct {
+		Addr string // address of the redis or kvrocks server
+	}
+}
+
+// Validate checks the driver and that a redis tree db has an address.
+func (c *TreeDBConfig) Validate() error {
+	switch c.Driver {
+	case "memory":
+	case "redis":
+		if c.Option.Addr == "" {
+			return errors.New("TreeDB.Option.Addr is empty")
+		}
+	default:
+		return fmt.Errorf("unknown TreeDB.Driver %q, memory or redis", c.Driver)
+	}
+	return nil
+}
+
 func init() {
+	NilAccountHash = ComputeNilAccountHash(AssetCounts)
+	EmptyAccountTreeRoot = ComputeEmptyAccountTreeRoot(NilAccountHash, AccountTreeDepth)
+}
+
+// ComputeNilAccountHash returns the leaf hash of an account with zero id hash, equity and
+// debt and assetCounts empty asset slots.
+func ComputeNilAccountHash(assetCounts int) []byte {
 	zero := &fr.Element{0, 0, 0, 0}
 	poseidonHasher := poseidon.NewPoseidon()
-	emptyAssets := make([]AccountAsset, AssetCounts)
-	for i := 0; i < AssetCounts; i++ {
-		emptyAssets[i].Index = uint16(i)
-		emptyAssets[i].Balance = 0 // [new]
-	}
+	emptyAssets := PaddingAccountAssets(nil, assetCounts)
 	emptyAssetCommitment := ComputeUserAssetsCommitment(&poseidonHasher, emptyAssets)
 	tempHash := poseidon.Poseidon(zero, zero, zero, new(fr.Element).SetBytes(emptyAssetCommitment)).Bytes()
-	NilAccountHash = tempHash[:]
+	return tempHash[:]
+}
+
+// ComputeEmptyAccountTreeRoot returns the root of the account tree of depth whose leaves
+// are all nilAccountHash.
+func ComputeEmptyAccountTreeRoot(nilAccountHash []byte, depth int) []byte {
+	root := nilAccountHash
+	for i := 0; i < depth; i++ {
+		root = poseidon.PoseidonBytes(root, root)
+	}
+	return root
 }
 
 func NewAccountTree(driver string, addr string) (accountTree bsmt.SparseMerkleTree, err error) {
@@ -54,6 +95,8 @@ func NewAccountTree(driver string, addr string) (accountTree bsmt.SparseMerkleTr
 		if err != nil {
 			return nil, err
 		}
+	} else {
+		return nil, fmt.Errorf("unknown tree db driver %q", driver)
 	}
 
 	accountTree, err = bsmt.NewBNBSparseMerkleTree(hasher, db, AccountTreeDepth, NilAccountHash)
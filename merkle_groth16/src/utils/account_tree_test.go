@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEmptyAccountTreeRoot(t *testing.T) {
+	accountTree, err := NewAccountTree("memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(accountTree.Root(), EmptyAccountTreeRoot) {
+		t.Fatalf("empty account tree root %x, derived %x", accountTree.Root(), EmptyAccountTreeRoot)
+	}
+	if bytes.Equal(ComputeNilAccountHash(AssetCounts-1), NilAccountHash) ||
+		bytes.Equal(ComputeEmptyAccountTreeRoot(NilAccountHash, AccountTreeDepth-1), EmptyAccountTreeRoot) {
+		t.Fatal("the empty account tree doesn't depend on the asset counts and depth")
+	}
+}
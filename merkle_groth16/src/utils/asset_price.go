@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// ParseAssetPrices reads a json object which maps every asset symbol to its usd price,
+// e.g. {"btc": "26000.5", "usdt": "1"}.
+func ParseAssetPrices(name string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var prices map[string]string
+	err = json.Unmarshal(content, &prices)
+	if err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+// ConvertPriceStrToBasePrice converts a usd price per coin to CexAssetInfo.BasePrice: the
+// price scaled by PriceMultiplier, and by BalanceMultiplier / TwoDigitsBalanceMultiplier
+// more for AssetTypeForTwoDigits as their balances are scaled by 1e2 instead of 1e8.
+func ConvertPriceStrToBasePrice(symbol string, price string) (uint64, error) {
+	multiplier := int64(PriceMultiplier)
+	if AssetTypeForTwoDigits[symbol] {
+		multiplier = PriceMultiplier * (BalanceMultiplier / TwoDigitsBalanceMultiplier)
+	}
+	return ConvertFloatStrToUint64(price, multiplier)
+}
+
+// ComputeAccountEquityAndDebt computes the price weighted sums of the positive and the
+// negative balances of assets. Equity is rounded down and debt is rounded up, which is
+// exactly what GroupUserCircuit checks.
+func ComputeAccountEquityAndDebt(assets []AccountAsset, cexAssets []CexAssetInfo) (equity *big.Int, debt *big.Int) {
+	equity = new(big.Int)
+	debt = new(big.Int)
+	value := new(big.Int)
+	for i := 0; i < len(assets); i++ {
+		value.SetInt64(assets[i].Balance)
+		value.Mul(value, new(big.Int).SetUint64(cexAssets[assets[i].Index].BasePrice))
+		if value.Sign() >= 0 {
+			equity.Add(equity, value)
+		} else {
+			debt.Sub(debt, value)
+		}
+	}
+	multiplier := big.NewInt(PriceMultiplier)
+	equity.Quo(equity, multiplier)
+	debt.Add(debt, new(big.Int).Sub(multiplier, big.NewInt(1)))
+	debt.Quo(debt, multiplier)
+	return equity, debt
+}
+
+// maxReportedInvalidAccounts bounds the account indexes listed in the error of
+// ApplyAssetPrices, every invalid account is logged
+const maxReportedInvalidAccounts = 100
+
+// ApplyAssetPrices sets the BasePrice of cexAssets from priceFile and replaces TotalEquity
+// and TotalDebt of every account with the price weighted sums of its assets, which are the
+// totals the circuit proves. It fails, listing the offending accounts, if the totals of
+// any account overflow uint64 or its debt is bigger than its equity, no account is dropped.
+func ApplyAssetPrices(accounts []AccountInfo, cexAssets []CexAssetInfo, priceFile string) ([]AccountInfo, error) {
+	prices, err := ParseAssetPrices(priceFile)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(cexAssets); i++ {
+		price, ok := prices[cexAssets[i].Symbol]
+		if !ok {
+			return nil, fmt.Errorf("missing price of asset %s", cexAssets[i].Symbol)
+		}
+		cexAssets[i].BasePrice, err = ConvertPriceStrToBasePrice(cexAssets[i].Symbol, price)
+		if err != nil {
+			return nil, fmt.Errorf("invalid price of asset %s: %s", cexAssets[i].Symbol, err.Error())
+		}
+	}
+
+	var invalidAccounts []string
+	invalidCounts := 0
+	for i := 0; i < len(accounts); i++ {
+		equity, debt := ComputeAccountEquityAndDebt(accounts[i].Assets, cexAssets)
+		if !equity.IsUint64() || !debt.IsUint64() || equity.Cmp(debt) < 0 {
+			logx.Errorw("data wrong: invalid price weighted equity and debt", logx.Field("accountIndex", accounts[i].AccountIndex),
+				logx.Field("accountId", hex.EncodeToString(accounts[i].AccountId)),
+				logx.Field("totalEquity", equity.String()), logx.Field("totalDebt", debt.String()))
+			invalidCounts += 1
+			if len(invalidAccounts) < maxReportedInvalidAccounts {
+				invalidAccounts = append(invalidAccounts, strconv.FormatUint(uint64(accounts[i].AccountIndex), 10))
+			} else if len(invalidAccounts) == maxReportedInvalidAccounts {
+				invalidAccounts = append(invalidAccounts, "...")
+			}
+			continue
+		}
+		accounts[i].TotalEquity = equity
+		accounts[i].TotalDebt = debt
+	}
+	if invalidCounts > 0 {
+		return nil, fmt.Errorf("%d accounts have debt bigger than equity or overflowing totals at the asset prices of %s: %s",
+			invalidCounts, priceFile, strings.Join(invalidAccounts, ", "))
+	}
+	return accounts, nil
+}
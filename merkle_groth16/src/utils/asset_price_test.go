@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestAssetPrices(t *testing.T, content string) string {
+	priceFile := filepath.Join(t.TempDir(), "asset_prices.json")
+	err := ioutil.WriteFile(priceFile, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priceFile
+}
+
+func TestApplyAssetPrices(t *testing.T) {
+	priceFile := writeTestAssetPrices(t, `{"btc": "2", "usdt": "1"}`)
+	newCexAssets := func() []CexAssetInfo {
+		return []CexAssetInfo{{Symbol: "btc", Index: 0}, {Symbol: "usdt", Index: 1}}
+	}
+	newAccounts := func() []AccountInfo {
+		return []AccountInfo{
+			{AccountIndex: 0, Assets: []AccountAsset{{Index: 0, Balance: 3}, {Index: 1, Balance: -5}}},
+			{AccountIndex: 1, Assets: []AccountAsset{{Index: 1, Balance: 7}}},
+		}
+	}
+
+	cexAssets := newCexAssets()
+	accounts, err := ApplyAssetPrices(newAccounts(), cexAssets, priceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cexAssets[0].BasePrice != 2*PriceMultiplier || cexAssets[1].BasePrice != PriceMultiplier {
+		t.Fatalf("unexpected base prices %d %d", cexAssets[0].BasePrice, cexAssets[1].BasePrice)
+	}
+	if len(accounts) != 2 || accounts[0].TotalEquity.Cmp(big.NewInt(6)) != 0 || accounts[0].TotalDebt.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("unexpected totals of account 0: %v", accounts[0])
+	}
+
+	// account 0 owes more than it holds, nothing is dropped silently
+	invalid := newAccounts()
+	invalid[0].Assets[1].Balance = -7
+	_, err = ApplyAssetPrices(invalid, newCexAssets(), priceFile)
+	if err == nil || !strings.Contains(err.Error(), "1 accounts") || !strings.HasSuffix(err.Error(), ": 0") {
+		t.Fatalf("expected account 0 to be reported, got %v", err)
+	}
+
+	_, err = ApplyAssetPrices(newAccounts(), newCexAssets(), writeTestAssetPrices(t, `{"btc": "2"}`))
+	if err == nil || !strings.Contains(err.Error(), "usdt") {
+		t.Fatalf("expected missing price of usdt, got %v", err)
+	}
+}
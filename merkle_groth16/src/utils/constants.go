@@ -10,7 +10,27 @@ const (
 	BatchCreateUserOpsCounts = 500 // batch size
 	AccountTreeDepth         = 28  // SMT height
 	AssetCounts              = 174
-	RedisLockKey             = "prover_mutex_key"
+	BatchWitnessLeaseSeconds = 60 // a prover renews its lease every third of it
+	BatchWitnessMaxAttempts  = 3  // default proving attempts of a batch before it fails
+
+	// rough peak memory of the solved wires, the a, b, c and h vectors and their filtered
+	// copies of groth16.ProveRoll per constraint, the key segments it reads per proof are
+	// estimated by their file sizes, see prover.loadZkKeys
+	ProofMemoryBytesPerConstraint = 1024
+
+	BalanceMultiplier          = 100000000 // asset balances are scaled by 1e8
+	TwoDigitsBalanceMultiplier = 100       // except for AssetTypeForTwoDigits
+	PriceMultiplier            = 100000000 // TotalEquity = sum(balance * BasePrice) / PriceMultiplier
+
+	// every user asset slot is packed as Index * 2^64 + (Balance + 2^63) into 72 bits,
+	// and UserAssetsPerElement slots are packed into one field element before hashing
+	UserAssetIndexBits    = 8 // 2^8 >= AssetCounts
+	UserAssetBits         = 64 + UserAssetIndexBits
+	UserAssetsPerElement  = 3
+	SparseUserAssetCounts = 8 // asset slots of a user in the sparse circuit
+
+	UserInclusionClaimCounts = 4            // asset claims of the user inclusion circuit
+	UserInclusionZkKeyName   = "zkpor_user" // key base name of the user inclusion circuit
 )
 
 var (
@@ -19,6 +39,12 @@ var (
 	Uint64MaxValueBigIntSquare, _ = new(big.Int).SetString("340282366920938463463374607431768211456", 10) // 2^128
 	Uint64MaxValueFr              = new(fr.Element).SetBigInt(Uint64MaxValueBigInt)                       // 2^64
 	Uint64MaxValueFrSquare        = new(fr.Element).SetBigInt(Uint64MaxValueBigIntSquare)                 // 2^128
+	// UserAssetCountsTiers are the asset slots per user of the batch circuits, users
+	// with at most SparseUserAssetCounts non-zero assets are proven by the sparse one
+	UserAssetCountsTiers = []int{SparseUserAssetCounts, AssetCounts}
+	// BatchCreateUserOpsCountsTiers are the batch sizes of the batch circuits, the last
+	// batch is proven by the smallest one which holds the remaining accounts
+	BatchCreateUserOpsCountsTiers = []int{20, 100, BatchCreateUserOpsCounts}
 	AssetTypeForTwoDigits         = map[string]bool{
 		"ladys":    true,
 		"brise":    true,
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	DbDriverMysql    = "mysql"
+	DbDriverPostgres = "postgres"
+	DbDriverSqlite   = "sqlite"
+)
+
+// ValidateDbDriver checks that driver is a supported db, mysql if empty.
+func ValidateDbDriver(driver string) error {
+	switch driver {
+	case "", DbDriverMysql, DbDriverPostgres, DbDriverSqlite:
+		return nil
+	}
+	return fmt.Errorf("unknown DbDriver %q, mysql, postgres or sqlite", driver)
+}
+
+// OpenDB opens the db of dataSource by driver, mysql if empty, its sql statements are
+// logged only if config.SqlDebug is set. dataSource is a mysql dsn, a postgres url or
+// key=value dsn, or the file of a sqlite db.
+func OpenDB(driver string, dataSource string, config LogConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch driver {
+	case "", DbDriverMysql:
+		dialector = mysql.Open(dataSource)
+	case DbDriverPostgres:
+		dialector = postgres.Open(dataSource)
+	case DbDriverSqlite:
+		dialector = sqlite.Open(dataSource)
+	default:
+		return nil, ValidateDbDriver(driver)
+	}
+	logLevel := logger.Silent
+	if config.SqlDebug {
+		logLevel = logger.Info
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.New(gormLogWriter{}, logger.Config{
+			SlowThreshold:             60 * time.Second,
+			LogLevel:                  logLevel,
+			IgnoreRecordNotFoundError: true,
+			Colorful:                  false,
+		}),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if driver == DbDriverSqlite {
+		// sqlite has a single writer, the workers of the services queue on one connection
+		// instead of failing with a locked db
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
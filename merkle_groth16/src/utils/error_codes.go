@@ -3,7 +3,9 @@ package utils
 import "errors"
 
 var (
-	DbErrSqlOperation  = errors.New("unknown sql operation error")
-	DbErrNotFound      = errors.New("sql: no rows in result set")
-	GetRedisLockFailed = errors.New("get lock failed")
+	DbErrSqlOperation = errors.New("unknown sql operation error")
+	DbErrNotFound     = errors.New("sql: no rows in result set")
+
+	BatchWitnessLeaseLost = errors.New("batch witness lease lost")
+	BatchWitnessClaimed   = errors.New("batch witness is claimed by another prover")
 )
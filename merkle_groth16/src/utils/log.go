@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// LogConfig is the "Log" section of the service configs.
+type LogConfig struct {
+	Level    string // debug, info, error or severe, info if empty
+	Encoding string // json or plain, json if empty
+	SqlDebug bool   // log every sql statement
+}
+
+// SetDefaults sets the info level and the json encoding.
+func (c *LogConfig) SetDefaults() {
+	c.Level = "info"
+	c.Encoding = "json"
+}
+
+// Validate checks the level and the encoding.
+func (c *LogConfig) Validate() error {
+	switch c.Level {
+	case "", "debug", "info", "error", "severe":
+	default:
+		return fmt.Errorf("unknown Log.Level %q", c.Level)
+	}
+	switch c.Encoding {
+	case "", "json", "plain":
+	default:
+		return fmt.Errorf("unknown Log.Encoding %q", c.Encoding)
+	}
+	return nil
+}
+
+// SetupLogger writes the logx logs of service to stdout, every line carries the service
+// name in the field "service".
+func SetupLogger(service string, config LogConfig) {
+	level, encoding := config.Level, config.Encoding
+	if level == "" {
+		level = "info"
+	}
+	if encoding == "" {
+		encoding = "json"
+	}
+	err := logx.SetUp(logx.LogConf{
+		ServiceName:         service,
+		Mode:                "console",
+		Encoding:            encoding,
+		Level:               level,
+		StackCooldownMillis: 100,
+	})
+	if err != nil {
+		panic(err.Error())
+	}
+	logx.AddGlobalFields(logx.Field("service", service))
+}
+
+type gormLogWriter struct{}
+
+func (gormLogWriter) Printf(format string, v ...interface{}) {
+	logx.Infow(fmt.Sprintf(format, v...), logx.Field("source", "sql"))
+}
+
+// LogPanic logs a panic of the calling goroutine with its stack before it crashes the
+// process, deferred first thing in the main functions.
+func LogPanic() {
+	if r := recover(); r != nil {
+		logx.Errorw("panic", logx.Field("error", fmt.Sprint(r)), logx.Field("stack", string(debug.Stack())))
+		logx.Close()
+		panic(r)
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+var (
+	WitnessBatchesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "por", Subsystem: "witness", Name: "batches_total",
+		Help: "Batch witnesses written to db.",
+	})
+	WitnessTreeCommitHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "por", Subsystem: "witness", Name: "tree_commit_seconds",
+		Help: "Time of the account tree commit of a batch.",
+	})
+	// WitnessQueueGauge is the number of batch witnesses by status, published, received,
+	// finished or failed.
+	WitnessQueueGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "por", Subsystem: "witness", Name: "queue_depth",
+		Help: "Batch witnesses by status.",
+	}, []string{"status"})
+	ProverBatchesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "por", Subsystem: "prover", Name: "batches_proven_total",
+		Help: "Batch proofs written to db.",
+	})
+	ProverFailuresCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "por", Subsystem: "prover", Name: "failures_total",
+		Help: "Failed proving attempts.",
+	})
+	// a batch proof takes seconds up to tens of minutes
+	ProverProofHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "por", Subsystem: "prover", Name: "proof_seconds",
+		Help:    "Time of generating a batch proof.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+	ProverVerifyHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "por", Subsystem: "prover", Name: "verify_seconds",
+		Help: "Time of verifying a batch proof.",
+	})
+	UserProofsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "por", Subsystem: "userproof", Name: "proofs_total",
+		Help: "User proofs written to db.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(WitnessBatchesCounter, WitnessTreeCommitHistogram, WitnessQueueGauge,
+		ProverBatchesCounter, ProverFailuresCounter, ProverProofHistogram, ProverVerifyHistogram,
+		UserProofsCounter)
+}
+
+// StartMetricsServer serves the metrics at http://addr/metrics, it does nothing if addr is
+// empty. A failing server is only reported, the service keeps running without it.
+func StartMetricsServer(addr string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			logx.Errorw("metrics server failed", logx.Field("error", err.Error()))
+		}
+	}()
+	logx.Infow("metrics are served", logx.Field("addr", addr))
+}
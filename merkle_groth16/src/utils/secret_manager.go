@@ -4,51 +4,240 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/go-sql-driver/mysql"
 )
 
-func GetSecretFromAws(secretId string) (string, error) {
-	region := "ap-northeast-1"
-	config, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+const (
+	DefaultAwsRegion    = "ap-northeast-1"
+	DefaultSecretKey    = "pg_password" // key of the password in the json secrets of aws and vault
+	vaultRequestTimeout = 10 * time.Second
+)
+
+// SecretProvider reads the secret name from a secret store.
+type SecretProvider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// EnvSecretProvider reads the secret from the environment variable name.
+type EnvSecretProvider struct{}
+
+func (EnvSecretProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("secret env %s is not set", name)
+	}
+	return value, nil
+}
 
+// FileSecretProvider reads the secret from the file name, e.g. a docker secret in
+// /run/secrets, without the trailing newline.
+type FileSecretProvider struct{}
+
+func (FileSecretProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	content, err := ioutil.ReadFile(name)
 	if err != nil {
-		panic("Couldn't load config!")
+		return "", err
 	}
-	conn := secretsmanager.NewFromConfig(config)
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
 
-	result, err := conn.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
-		SecretId: aws.String(secretId),
-	})
+// VaultSecretProvider reads the field Key of the vault kv secret at the api path name, e.g.
+// secret/data/por/mysql of the kv v2 engine mounted at secret.
+type VaultSecretProvider struct {
+	Addr   string // VAULT_ADDR if empty
+	Token  string // VAULT_TOKEN if empty
+	Key    string
+	Client *http.Client // a client with a timeout of 10 seconds if nil
+}
+
+func (p *VaultSecretProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	addr, token := p.Addr, p.Token
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if addr == "" {
+		return "", errors.New("vault address is not set")
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: vaultRequestTimeout}
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(name, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("X-Vault-Token", token)
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("read vault secret %s failed: %s", name, response.Status)
+	}
+	var secret struct {
+		Data map[string]json.RawMessage
+	}
+	err = json.NewDecoder(response.Body).Decode(&secret)
+	if err != nil {
+		return "", err
+	}
+	data := secret.Data
+	// the kv v2 engine nests the fields in data.data
+	if nested, ok := data["data"]; ok {
+		data = nil
+		err = json.Unmarshal(nested, &data)
+		if err != nil {
+			return "", err
+		}
+	}
+	value, ok := data[p.Key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %s", name, p.Key)
+	}
+	var s string
+	err = json.Unmarshal(value, &s)
+	if err != nil {
+		return "", fmt.Errorf("vault secret %s key %s is not a string", name, p.Key)
+	}
+	return s, nil
+}
+
+// AwsSecretProvider reads the field Key of the json secret name of aws secretsmanager.
+type AwsSecretProvider struct {
+	Region string
+	Key    string
+}
 
+func (p *AwsSecretProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	awsConfig, err := config.LoadDefaultConfig(ctx, config.WithRegion(p.Region))
+	if err != nil {
+		return "", fmt.Errorf("load aws config failed: %w", err)
+	}
+	conn := secretsmanager.NewFromConfig(awsConfig)
+	result, err := conn.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
 	if err != nil {
 		return "", err
 	}
+	if result.SecretString == nil {
+		return "", fmt.Errorf("aws secret %s is not a string", name)
+	}
+	var values map[string]string
+	err = json.Unmarshal([]byte(*result.SecretString), &values)
+	if err != nil {
+		return "", fmt.Errorf("aws secret %s is not a json object: %w", name, err)
+	}
+	value, ok := values[p.Key]
+	if !ok {
+		return "", fmt.Errorf("aws secret %s has no key %s", name, p.Key)
+	}
+	return value, nil
+}
 
-	return *result.SecretString, err
+// NewSecretProvider returns the provider and the secret name of spec, one of
+//
+//	env:NAME                             the environment variable NAME
+//	file:PATH                            the file PATH, e.g. file:/run/secrets/mysql_password
+//	vault:PATH[?addr=ADDR][#KEY]         the vault kv secret at the api path PATH
+//	aws:SECRET_ID[?region=REGION][#KEY]  the aws secretsmanager secret SECRET_ID
+//
+// KEY is DefaultSecretKey and REGION is DefaultAwsRegion if omitted. A spec of another form
+// is an aws secret id with the defaults.
+func NewSecretProvider(spec string) (SecretProvider, string, error) {
+	u, err := url.Parse(spec)
+	if err != nil || u.Scheme == "" {
+		return &AwsSecretProvider{Region: DefaultAwsRegion, Key: DefaultSecretKey}, spec, nil
+	}
+	name := u.Opaque
+	if name == "" {
+		name = u.Path
+	}
+	key := u.Fragment
+	if key == "" {
+		key = DefaultSecretKey
+	}
+	switch u.Scheme {
+	case "env":
+		return EnvSecretProvider{}, name, nil
+	case "file":
+		return FileSecretProvider{}, name, nil
+	case "vault":
+		return &VaultSecretProvider{Addr: u.Query().Get("addr"), Key: key}, name, nil
+	case "aws":
+		region := u.Query().Get("region")
+		if region == "" {
+			region = DefaultAwsRegion
+		}
+		return &AwsSecretProvider{Region: region, Key: key}, name, nil
+	}
+	// e.g. the arn of an aws secret
+	return &AwsSecretProvider{Region: DefaultAwsRegion, Key: DefaultSecretKey}, spec, nil
 }
 
-// user name can't include ":"
-func GetMysqlSource(source string, secretId string) (string, error) {
-	value, err := GetSecretFromAws(secretId)
+// GetSecret reads the secret of spec, see NewSecretProvider.
+func GetSecret(ctx context.Context, spec string) (string, error) {
+	provider, name, err := NewSecretProvider(spec)
 	if err != nil {
 		return "", err
 	}
+	return provider.GetSecret(ctx, name)
+}
+
+// SetMysqlPassword returns the mysql dsn source with its password replaced by passwd.
+func SetMysqlPassword(source string, passwd string) (string, error) {
+	mysqlConfig, err := mysql.ParseDSN(source)
+	if err != nil {
+		return "", fmt.Errorf("the source format is wrong: %w", err)
+	}
+	mysqlConfig.Passwd = passwd
+	return mysqlConfig.FormatDSN(), nil
+}
 
-	var result map[string]string
-	err = json.Unmarshal([]byte(value), &result)
+// SetPostgresPassword returns the postgres url or key=value dsn source with its password
+// replaced by passwd.
+func SetPostgresPassword(source string, passwd string) (string, error) {
+	if strings.HasPrefix(source, "postgres://") || strings.HasPrefix(source, "postgresql://") {
+		u, err := url.Parse(source)
+		if err != nil {
+			return "", fmt.Errorf("the source format is wrong: %w", err)
+		}
+		u.User = url.UserPassword(u.User.Username(), passwd)
+		return u.String(), nil
+	}
+	// the last password of a key=value dsn wins
+	passwd = strings.ReplaceAll(strings.ReplaceAll(passwd, `\`, `\\`), `'`, `\'`)
+	return source + " password='" + passwd + "'", nil
+}
+
+// GetDataSource returns the dsn source of the db driver with the password of the secret
+// spec, see NewSecretProvider.
+func GetDataSource(driver string, source string, spec string) (string, error) {
+	passwd, err := GetSecret(context.Background(), spec)
 	if err != nil {
-		panic(err.Error())
+		return "", err
 	}
-	passwd := result["pg_password"]
-	aIndex := strings.Index(source, ":")
-	bIndex := strings.Index(source, "@tcp")
-	if aIndex == -1 || bIndex == -1 || bIndex <= aIndex {
-		return "", errors.New("the source format is wrong")
+	switch driver {
+	case "", DbDriverMysql:
+		return SetMysqlPassword(source, passwd)
+	case DbDriverPostgres:
+		return SetPostgresPassword(source, passwd)
 	}
-	newSource := source[:aIndex+1] + passwd + source[bIndex:]
-	return newSource, nil
+	return "", fmt.Errorf("a %s db has no password", driver)
 }
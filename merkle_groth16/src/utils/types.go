@@ -4,8 +4,13 @@ import "math/big"
 
 type CexAssetInfo struct {
 	TotalBalance int64
-	Symbol       string
-	Index        uint32
+	// usd price of one coin scaled by PriceMultiplier (1e8) against balances scaled by
+	// BalanceMultiplier (1e8). Balances of AssetTypeForTwoDigits are scaled by 1e2, so
+	// their price is scaled by another 1e6 and balance * BasePrice / PriceMultiplier is
+	// the usd value scaled by 1e8 for every asset
+	BasePrice uint64
+	Symbol    string
+	Index     uint32
 }
 
 type CexAssetInfo2 struct {
@@ -21,6 +26,13 @@ type AccountAsset struct {
 	Balance int64
 }
 
+// UserAssetClaim claims that the balance of the asset Index is at least MinBalance, it is
+// proven by the user inclusion circuit without revealing the other assets
+type UserAssetClaim struct {
+	Index      uint16
+	MinBalance int64
+}
+
 type AccountAsset2 struct {
 	Index  uint16
 	Equity uint64
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// The assets of a user are committed as a fixed number of slots. A batch circuit has
+// one of the UserAssetCountsTiers slots per user: the dense circuit has one slot for every
+// asset in index order, the sparse circuit has SparseUserAssetCounts slots holding the
+// non-zero assets and zero-balance padding with strictly increasing indexes.
+
+var userAssetBalanceOffset = new(big.Int).Lsh(big.NewInt(1), 63)
+
+// GetUserAssetCounts returns the smallest tier of UserAssetCountsTiers which can hold the
+// non-zero assets.
+func GetUserAssetCounts(assets []AccountAsset) int {
+	nonZeroCounts := 0
+	for i := 0; i < len(assets); i++ {
+		if assets[i].Balance != 0 {
+			nonZeroCounts += 1
+		}
+	}
+	for _, counts := range UserAssetCountsTiers {
+		if nonZeroCounts <= counts {
+			return counts
+		}
+	}
+	panic(fmt.Sprintf("too many assets: %d", nonZeroCounts))
+}
+
+// PaddingAccountAssets lays the non-zero assets out as userAssetCounts slots. The dense
+// layout has the asset of index i in slot i, otherwise the non-zero assets are padded with
+// the smallest unused indexes and sorted by index.
+func PaddingAccountAssets(assets []AccountAsset, userAssetCounts int) []AccountAsset {
+	paddingAssets := make([]AccountAsset, 0, userAssetCounts)
+	used := make([]bool, AssetCounts)
+	for i := 0; i < len(assets); i++ {
+		if assets[i].Balance != 0 {
+			paddingAssets = append(paddingAssets, assets[i])
+			used[assets[i].Index] = true
+		}
+	}
+	if len(paddingAssets) > userAssetCounts {
+		panic(fmt.Sprintf("%d assets exceed %d slots", len(paddingAssets), userAssetCounts))
+	}
+	for i := 0; i < AssetCounts && len(paddingAssets) < userAssetCounts; i++ {
+		if !used[i] {
+			paddingAssets = append(paddingAssets, AccountAsset{Index: uint16(i)})
+		}
+	}
+	sort.Slice(paddingAssets, func(i, j int) bool {
+		return paddingAssets[i].Index < paddingAssets[j].Index
+	})
+	return paddingAssets
+}
+
+// ArrangeAccountsByUserAssetCounts orders accounts by the tier of their asset counts,
+// the largest first, re-indexes them and pads the assets of every account to the tier of
+// its batch. A batch takes the tier of its first account, so only the batch on the tier
+// boundary proves sparse users with the dense circuit, and the padding accounts appended
+// to the last batch use the sparse one. The user proofs carry the new index, so the old and
+// new index of every moved account are logged.
+func ArrangeAccountsByUserAssetCounts(accounts []AccountInfo) []AccountInfo {
+	userAssetCounts := make([]int, len(accounts))
+	for i := 0; i < len(accounts); i++ {
+		userAssetCounts[i] = GetUserAssetCounts(accounts[i].Assets)
+	}
+	order := make([]int, len(accounts))
+	for i := 0; i < len(order); i++ {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return userAssetCounts[order[i]] > userAssetCounts[order[j]]
+	})
+	arrangedAccounts := make([]AccountInfo, len(accounts))
+	batchUserAssetCounts := 0
+	movedCounts := 0
+	for i := 0; i < len(order); i++ {
+		if i%BatchCreateUserOpsCounts == 0 {
+			batchUserAssetCounts = userAssetCounts[order[i]]
+		}
+		arrangedAccounts[i] = accounts[order[i]]
+		if arrangedAccounts[i].AccountIndex != uint32(i) {
+			logx.Infow("account re-indexed", logx.Field("accountId", hex.EncodeToString(arrangedAccounts[i].AccountId)),
+				logx.Field("oldAccountIndex", arrangedAccounts[i].AccountIndex), logx.Field("accountIndex", i))
+			movedCounts += 1
+		}
+		arrangedAccounts[i].AccountIndex = uint32(i)
+		arrangedAccounts[i].Assets = PaddingAccountAssets(arrangedAccounts[i].Assets, batchUserAssetCounts)
+	}
+	logx.Infow("accounts arranged by user asset counts", logx.Field("accounts", len(accounts)), logx.Field("reindexed", movedCounts))
+	return arrangedAccounts
+}
+
+// ComputeUserAssetsCommitment hashes the asset slots of a user, every UserAssetsPerElement
+// slots are packed into one element as slot[0] + slot[1] * 2^72 + slot[2] * 2^144. It is
+// the same as the circuit.
+func ComputeUserAssetsCommitment(hasher *hash.Hash, assets []AccountAsset) []byte {
+	(*hasher).Reset()
+	for i := 0; i < len(assets); i += UserAssetsPerElement {
+		last := i + UserAssetsPerElement - 1
+		if last >= len(assets) {
+			last = len(assets) - 1
+		}
+		element := new(big.Int)
+		for j := last; j >= i; j-- {
+			element.Lsh(element, UserAssetBits)
+			element.Add(element, PackUserAsset(assets[j]))
+		}
+		(*hasher).Write(element.Bytes())
+	}
+	return (*hasher).Sum(nil)
+}
+
+// PackUserAsset returns Index * 2^64 + (Balance + 2^63).
+func PackUserAsset(asset AccountAsset) *big.Int {
+	packed := new(big.Int).SetUint64(uint64(asset.Index))
+	packed.Lsh(packed, 64)
+	packed.Add(packed, userAssetBalanceOffset)
+	packed.Add(packed, new(big.Int).SetInt64(asset.Balance))
+	return packed
+}
+
+// GetBatchCreateUserOpsCounts returns the smallest tier of BatchCreateUserOpsCountsTiers
+// which can hold opsCounts accounts.
+func GetBatchCreateUserOpsCounts(opsCounts int) int {
+	for _, counts := range BatchCreateUserOpsCountsTiers {
+		if opsCounts <= counts {
+			return counts
+		}
+	}
+	panic(fmt.Sprintf("too many accounts in a batch: %d", opsCounts))
+}
+
+// GetZkKeyName returns the key name of the batch circuit of batchCounts users with
+// userAssetCounts asset slots per user. zkKeyName is the one of the dense circuit of
+// BatchCreateUserOpsCounts users, e.g. zkpor500, smaller batches replace its batch size
+// suffix, e.g. zkpor20_8.
+func GetZkKeyName(zkKeyName string, batchCounts int, userAssetCounts int) string {
+	if batchCounts != BatchCreateUserOpsCounts {
+		zkKeyName = strings.TrimSuffix(zkKeyName, strconv.Itoa(BatchCreateUserOpsCounts)) + strconv.Itoa(batchCounts)
+	}
+	if userAssetCounts == AssetCounts {
+		return zkKeyName
+	}
+	return zkKeyName + "_" + strconv.Itoa(userAssetCounts)
+}
+
+// ValidateZkKeyName checks that zkKeyName is the key name of the dense circuit of
+// BatchCreateUserOpsCounts users, GetZkKeyName derives the other ones by its suffix.
+func ValidateZkKeyName(zkKeyName string) error {
+	if !strings.HasSuffix(zkKeyName, strconv.Itoa(BatchCreateUserOpsCounts)) {
+		return fmt.Errorf("ZkKeyName %q doesn't end with the batch size %d", zkKeyName, BatchCreateUserOpsCounts)
+	}
+	return nil
+}
+
+// GetUserInclusionZkKeyName returns the key name of the user inclusion circuit for
+// userAssetCounts asset slots, zkKeyName is the one of the dense circuit.
+func GetUserInclusionZkKeyName(zkKeyName string, userAssetCounts int) string {
+	return GetZkKeyName(zkKeyName, BatchCreateUserOpsCounts, userAssetCounts)
+}
+
+// PaddingUserAssetClaims pads claims to UserInclusionClaimCounts with claims of the
+// smallest balance, which hold for every asset.
+func PaddingUserAssetClaims(claims []UserAssetClaim) []UserAssetClaim {
+	if len(claims) > UserInclusionClaimCounts {
+		panic(fmt.Sprintf("%d claims exceed %d", len(claims), UserInclusionClaimCounts))
+	}
+	paddingClaims := make([]UserAssetClaim, UserInclusionClaimCounts)
+	copy(paddingClaims, claims)
+	for i := len(claims); i < UserInclusionClaimCounts; i++ {
+		paddingClaims[i].MinBalance = math.MinInt64
+	}
+	return paddingClaims
+}
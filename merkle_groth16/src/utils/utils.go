@@ -7,7 +7,6 @@ import (
 	"encoding/csv"
 	"encoding/gob"
 	"errors"
-	"fmt"
 	"hash"
 	"io/ioutil"
 	"math/big"
@@ -20,13 +19,17 @@ import (
 	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
 	"github.com/consensys/gnark-crypto/ecc/bn254/fr/poseidon"
 	"github.com/shopspring/decimal"
+	"github.com/zeromicro/go-zero/core/logx"
 	//"crypto/sha1"
 )
 
 func ConvertAssetInfoToBytes(value any) []byte {
 	switch t := value.(type) {
 	case CexAssetInfo:
-		balanceBigInt := new(big.Int).SetInt64(t.TotalBalance)
+		// (TotalBalance + 2^63) * 2^64 + BasePrice, same packing as the circuit
+		balanceBigInt := new(big.Int).Add(new(big.Int).SetInt64(t.TotalBalance), userAssetBalanceOffset)
+		balanceBigInt.Lsh(balanceBigInt, 64)
+		balanceBigInt.Add(balanceBigInt, new(big.Int).SetUint64(t.BasePrice))
 		return balanceBigInt.Bytes()
 	default:
 		panic("not supported type")
@@ -41,18 +44,6 @@ func SelectAssetValue(expectAssetIndex int, currentAssetPosition int, assets []A
 	}
 }
 
-func ComputeUserAssetsCommitment(hasher *hash.Hash, assets []AccountAsset) []byte {
-	(*hasher).Reset()
-	userAssets := make([]AccountAsset, AssetCounts)
-	for p := 0; p < len(assets); p++ {
-		userAssets[assets[p].Index] = assets[p]
-	}
-	for i := 0; i < AssetCounts; i++ {
-		(*hasher).Write(new(big.Int).SetInt64(userAssets[i].Balance).Bytes())
-	}
-	return (*hasher).Sum(nil)
-}
-
 func ParseUserDataSet(dirname string) ([]AccountInfo, []CexAssetInfo, error) {
 	userFiles, err := ioutil.ReadDir(dirname)
 	if err != nil {
@@ -286,9 +277,8 @@ func ReadUserDataFromCsvFile(name string) ([]AccountInfo, []CexAssetInfo, error)
 			}
 
 			if err != nil {
-				//fmt.Println(cexAssetsInfo)
-				fmt.Println("the symbol is ", cexAssetsInfo[j].Symbol)
-				fmt.Println("account uid:", data[i][1], "balance data wrong:", err.Error())
+				logx.Errorw("balance data wrong", logx.Field("uid", data[i][1]), logx.Field("symbol", cexAssetsInfo[j].Symbol),
+					logx.Field("error", err.Error()))
 				invalidCounts += 1
 				continue
 			}
@@ -302,14 +292,14 @@ func ReadUserDataFromCsvFile(name string) ([]AccountInfo, []CexAssetInfo, error)
 
 		totalEquity, err := ConvertFloatStrToUint64(data[i][AssetCounts+2], multiplier)
 		if err != nil {
-			fmt.Println("account uid:", data[i][1], "TotalEquity data wrong:", err.Error())
+			logx.Errorw("TotalEquity data wrong", logx.Field("uid", data[i][1]), logx.Field("error", err.Error()))
 			invalidCounts += 1
 			continue
 		}
 		account.TotalEquity = new(big.Int).SetUint64(totalEquity)
 		totalDebt, err := ConvertFloatStrToUint64(data[i][AssetCounts+2+1], multiplier)
 		if err != nil {
-			fmt.Println("account uid:", data[i][1], "TotalDebt data wrong:", err.Error())
+			logx.Errorw("TotalDebt data wrong", logx.Field("uid", data[i][1]), logx.Field("error", err.Error()))
 			invalidCounts += 1
 			continue
 		}
@@ -321,7 +311,8 @@ func ReadUserDataFromCsvFile(name string) ([]AccountInfo, []CexAssetInfo, error)
 			accountIndex += 1
 		} else {
 			invalidCounts += 1
-			fmt.Println("account", data[i][1], "data wrong: total debt is bigger than equity:", account.TotalDebt, account.TotalEquity)
+			logx.Errorw("data wrong: total debt is bigger than equity", logx.Field("uid", data[i][1]),
+				logx.Field("totalDebt", account.TotalDebt.String()), logx.Field("totalEquity", account.TotalEquity.String()))
 		}
 
 		if i%100000 == 0 {
@@ -329,8 +320,7 @@ func ReadUserDataFromCsvFile(name string) ([]AccountInfo, []CexAssetInfo, error)
 		}
 	}
 	accounts = accounts[:accountIndex]
-	fmt.Println("The invalid accounts number is ", invalidCounts)
-	fmt.Println("The valid accounts number is ", len(accounts))
+	logx.Infow("user data parsed", logx.Field("invalidAccounts", invalidCounts), logx.Field("validAccounts", len(accounts)))
 	return accounts, cexAssetsInfo, nil
 }
 
@@ -372,24 +362,16 @@ func DecodeBatchWitness(data string) *BatchCreateUserWitness {
 	var witnessForCircuit BatchCreateUserWitness
 	b, err := base64.StdEncoding.DecodeString(data)
 	if err != nil {
-		fmt.Println("deserialize batch witness failed: ", err.Error())
+		logx.Errorw("deserialize batch witness failed", logx.Field("error", err.Error()))
 		return nil
 	}
 	unserializeBuf := bytes.NewBuffer(b)
 	dec := gob.NewDecoder(unserializeBuf)
 	err = dec.Decode(&witnessForCircuit)
 	if err != nil {
-		fmt.Println("unmarshal batch witness failed: ", err.Error())
+		logx.Errorw("unmarshal batch witness failed", logx.Field("error", err.Error()))
 		return nil
 	}
-	for i := 0; i < len(witnessForCircuit.CreateUserOps); i++ {
-		userAssets := make([]AccountAsset, AssetCounts)
-		storeUserAssets := witnessForCircuit.CreateUserOps[i].Assets
-		for p := 0; p < len(storeUserAssets); p++ {
-			userAssets[storeUserAssets[p].Index] = storeUserAssets[p]
-		}
-		witnessForCircuit.CreateUserOps[i].Assets = userAssets
-	}
 	return &witnessForCircuit
 }
 
@@ -402,7 +384,8 @@ func AccountInfoToHash(account *AccountInfo, hasher *hash.Hash) []byte {
 }
 
 func RecoverAfterCexAssets(witness *BatchCreateUserWitness) []CexAssetInfo {
-	cexAssets := witness.BeforeCexAssets
+	cexAssets := make([]CexAssetInfo, len(witness.BeforeCexAssets))
+	copy(cexAssets, witness.BeforeCexAssets)
 	for i := 0; i < len(witness.CreateUserOps); i++ {
 		for j := 0; j < len(witness.CreateUserOps[i].Assets); j++ {
 			asset := &witness.CreateUserOps[i].Assets[j]
@@ -410,12 +393,8 @@ func RecoverAfterCexAssets(witness *BatchCreateUserWitness) []CexAssetInfo {
 		}
 	}
 	// sanity check
-	hasher := poseidon.NewPoseidon()
-	for i := 0; i < len(cexAssets); i++ {
-		commitment := ConvertAssetInfoToBytes(cexAssets[i])
-		hasher.Write(commitment)
-	}
-	cexCommitment := hasher.Sum(nil)
+	totalCexAssets := RecoverAfterTotalCexAssets(witness)
+	cexCommitment := ComputeCexAssetsCommitment(cexAssets, totalCexAssets.AfterCEXTotalEquity, totalCexAssets.AfterCEXTotalDebt)
 	if string(cexCommitment) != string(witness.AfterCEXAssetsCommitment) {
 		panic("after cex commitment verify failed")
 	}
@@ -427,7 +406,9 @@ func RecoverAfterTotalCexAssets(witness *BatchCreateUserWitness) CexAssetsTotal
 	return totalCexAssets
 }
 
-func ComputeCexAssetsCommitment(cexAssetsInfo []CexAssetInfo) []byte {
+// ComputeCexAssetsCommitment hashes every cex asset followed by the cex total equity and
+// total debt, the same as the circuit does.
+func ComputeCexAssetsCommitment(cexAssetsInfo []CexAssetInfo, totalEquity uint64, totalDebt uint64) []byte {
 	hasher := poseidon.NewPoseidon()
 	emptyCexAssets := make([]CexAssetInfo, AssetCounts-len(cexAssetsInfo))
 	cexAssetsInfo = append(cexAssetsInfo, emptyCexAssets...)
@@ -435,5 +416,7 @@ func ComputeCexAssetsCommitment(cexAssetsInfo []CexAssetInfo) []byte {
 		commitment := ConvertAssetInfoToBytes(cexAssetsInfo[i])
 		hasher.Write(commitment)
 	}
+	hasher.Write(new(big.Int).SetUint64(totalEquity).Bytes())
+	hasher.Write(new(big.Int).SetUint64(totalDebt).Bytes())
 	return hasher.Sum(nil)
 }
@@ -1,14 +1,49 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
 	"merkleverifytool/merkle_groth16/src/utils"
 )
 
 type Config struct {
-	ProofTable    string
-	ZkKeyName     string
-	CexAssetsInfo []utils.CexAssetInfo
+	ProofTable       string
+	ZkKeyName        string
+	SummaryZkKeyName string
+	SummaryProofFile string
+	CexAssetsInfo    []utils.CexAssetInfo
+	CexTotalEquity   uint64
+	CexTotalDebt     uint64
+	Log              utils.LogConfig
+	// sha256 of the .vk.save files by key base name, the keys are not checked if empty
+	VerifyingKeyHashes map[string]string
+	// hex of the expected final account tree root, not checked if empty
+	AccountTreeRoot string
+	Workers         int    // concurrent batch proof verifications, the cpu cores if 0
+	CheckpointFile  string // verified batches are recorded and skipped on rerun, none if empty
+}
+
+func (c *Config) SetDefaults() {
+	c.Log.SetDefaults()
+	c.SummaryZkKeyName = "zkpor_summary"
+	c.SummaryProofFile = "summary_proof.json"
+}
+
+func (c *Config) Validate() error {
+	if c.ProofTable == "" {
+		return errors.New("ProofTable is empty")
+	}
+	if err := utils.ValidateZkKeyName(c.ZkKeyName); err != nil {
+		return err
+	}
+	if c.Workers < 0 {
+		return errors.New("Workers can't be negative")
+	}
+	if len(c.CexAssetsInfo) > utils.AssetCounts {
+		return fmt.Errorf("%d CexAssetsInfo exceed %d assets", len(c.CexAssetsInfo), utils.AssetCounts)
+	}
+	return c.Log.Validate()
 }
 
 type UserConfig struct {
@@ -20,3 +55,13 @@ type UserConfig struct {
 	Assets        []utils.AccountAsset
 	Proof         []string
 }
+
+func (c *UserConfig) Validate() error {
+	if c.Root == "" {
+		return errors.New("Root is empty")
+	}
+	if len(c.Proof) != utils.AccountTreeDepth {
+		return fmt.Errorf("Proof has %d hashes instead of %d", len(c.Proof), utils.AccountTreeDepth)
+	}
+	return nil
+}
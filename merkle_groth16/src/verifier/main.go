@@ -1,225 +1,97 @@
 package main
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/hex"
-	"encoding/json"
+	"crypto/ed25519"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"merkleverifytool/merkle_groth16/circuit"
-	"merkleverifytool/merkle_groth16/src/prover/prover"
+	"os"
+
+	"merkleverifytool/merkle_groth16/src/bundle"
+	"merkleverifytool/merkle_groth16/src/conf"
 	"merkleverifytool/merkle_groth16/src/utils"
 	"merkleverifytool/merkle_groth16/src/verifier/config"
-	"os"
+	"merkleverifytool/merkle_groth16/src/verifier/verifier"
 
-	"github.com/consensys/gnark-crypto/ecc"
-	"github.com/consensys/gnark-crypto/ecc/bn254/fr/poseidon"
-	"github.com/consensys/gnark/backend/groth16"
-	"github.com/consensys/gnark/frontend"
-	"github.com/gocarina/gocsv"
+	"github.com/zeromicro/go-zero/core/logx"
 )
 
 func main() {
 	userFlag := flag.Bool("user", false, "flag which indicates user proof verification")
+	summaryFlag := flag.Bool("summary", false, "flag which indicates cex summary proof verification")
+	bundleFlag := flag.String("bundle", "", "archive or directory of a proof bundle written by export, instead of the config")
+	publicKeyFlag := flag.String("public_key", "", "hex of the ed25519 public key which signed the bundle, or a file of it")
+	unsignedFlag := flag.Bool("unsigned", false, "skip the signature check of the bundle")
+	workersFlag := flag.Int("workers", 0, "concurrent batch proof verifications, Workers of the config if 0")
+	checkpointFlag := flag.String("checkpoint", "", "file recording the verified batches to resume from, CheckpointFile of the config if empty")
 	flag.Parse()
-	if *userFlag {
+	defer utils.LogPanic()
+	if *userFlag && !*summaryFlag {
+		utils.SetupLogger("verifier", utils.LogConfig{})
 		userConfig := &config.UserConfig{}
-		content, err := ioutil.ReadFile("src/verifier/config/user_config.json")
+		conf.MustLoad("src/verifier/config/user_config.json", userConfig)
+		err := verifier.VerifyUser(userConfig)
 		if err != nil {
-			panic(err.Error())
-		}
-		err = json.Unmarshal(content, userConfig)
-		if err != nil {
-			panic(err.Error())
-		}
-		root, err := hex.DecodeString(userConfig.Root)
-		if err != nil || len(root) != 32 {
-			panic("invalid account tree root")
-		}
-
-		var proof [][]byte
-		for i := 0; i < len(userConfig.Proof); i++ {
-			p, err := base64.StdEncoding.DecodeString(userConfig.Proof[i])
-			if err != nil || len(p) != 32 {
-				panic("invalid proof")
-			}
-			proof = append(proof, p)
-		}
-
-		// padding user assets
-		userAssets := make([]utils.AccountAsset, utils.AssetCounts)
-		for i := 0; i < utils.AssetCounts; i++ {
-			userAssets[i].Index = uint16(i)
-		}
-		for i := 0; i < len(userConfig.Assets); i++ {
-			userAssets[userConfig.Assets[i].Index] = userConfig.Assets[i]
-		}
-		hasher := poseidon.NewPoseidon()
-		assetCommitment := utils.ComputeUserAssetsCommitment(&hasher, userAssets)
-		hasher.Reset()
-		// compute new account leaf node hash
-		accountIdHash, err := hex.DecodeString(userConfig.AccountIdHash)
-		if err != nil || len(accountIdHash) != 32 {
-			panic("the AccountIdHash is invalid")
-		}
-		accountHash := poseidon.PoseidonBytes(accountIdHash, userConfig.TotalEquity.Bytes(), userConfig.TotalDebt.Bytes(), assetCommitment)
-		fmt.Printf("merkle leave hash: %x\n", accountHash)
-		verifyFlag := utils.VerifyMerkleProof(root, userConfig.AccountIndex, proof, accountHash)
-		if verifyFlag {
-			fmt.Println("verify pass!!!")
-		} else {
-			fmt.Println("verify failed...")
+			logx.Errorw("user proof verify failed", logx.Field("error", err.Error()))
 		}
-	} else {
+		logx.Close()
+		os.Exit(verifier.VerifyExitCode(err))
+	}
+	if *summaryFlag {
 		verifierConfig := &config.Config{}
-		content, err := ioutil.ReadFile("src/verifier/config/config.json")
-		if err != nil {
-			panic(err.Error())
-		}
-		err = json.Unmarshal(content, verifierConfig)
-		if err != nil {
-			panic(err.Error())
-		}
-
-		vk, err := prover.LoadVerifyingKey(verifierConfig.ZkKeyName)
-		if err != nil {
-			panic(err.Error())
-		}
-
-		f, err := os.Open(verifierConfig.ProofTable)
-		if err != nil {
-			panic(err.Error())
-		}
-		defer f.Close()
-		// index 4: proof_info, index 5: cex_asset_list_commitments
-		// index 6: account_tree_roots, index 7: batch_commitment
-		// index 8: batch_number
-		type Proof struct {
-			BatchNumber        int64    `csv:"BatchNumber"`
-			ZkProof            string   `csv:"ProofInfo"`
-			CexAssetCommitment []string `csv:"CexAssetListCommitments"`
-			AccountTreeRoots   []string `csv:"AccountTreeRoots"`
-			BatchCommitment    string   `csv:"BatchCommitment"`
-		}
-		tmpProofs := []*Proof{}
-
-		err = gocsv.UnmarshalFile(f, &tmpProofs)
+		conf.MustLoad("src/verifier/config/config.json", verifierConfig)
+		utils.SetupLogger("verifier", verifierConfig.Log)
+		err := verifier.VerifyCexSummary(verifierConfig)
 		if err != nil {
-			panic(err.Error())
+			logx.Errorw("summary proof verify failed", logx.Field("error", err.Error()))
 		}
-		fmt.Println("tmpproofs=", tmpProofs[0])
-		proofs := make([]Proof, len(tmpProofs))
-		for i := 0; i < len(tmpProofs); i++ {
-			proofs[tmpProofs[i].BatchNumber] = *tmpProofs[i]
-		}
-		batchNumber := int64(0)
-		prevCexAssetListCommitments := make([][]byte, 2)
-		prevAccountTreeRoots := make([][]byte, 2)
-		// depth-28 empty account tree root
-		emptyAccountTreeRoot, err := hex.DecodeString("2787c6e55c2da2a73e57628e70386add83fd42cb4da4c401269381e918944558")
-		//0118925954da77d1a4b241fd163e4373e2265c515cfa60af7fcd28c8cb9ad58a
-		if err != nil {
-			fmt.Println("wrong empty empty account tree root")
-			return
-		}
-
-		prevAccountTreeRoots[1] = emptyAccountTreeRoot
-		// according to asset price info to compute
-		cexAssetsInfo := make([]utils.CexAssetInfo, len(verifierConfig.CexAssetsInfo))
-		for i := 0; i < len(verifierConfig.CexAssetsInfo); i++ {
-			cexAssetsInfo[verifierConfig.CexAssetsInfo[i].Index] = verifierConfig.CexAssetsInfo[i]
-		}
-		emptyCexAssetsInfo := make([]utils.CexAssetInfo, len(cexAssetsInfo))
-		copy(emptyCexAssetsInfo, cexAssetsInfo)
-		for i := 0; i < len(emptyCexAssetsInfo); i++ {
-			emptyCexAssetsInfo[i].TotalBalance = 0
-		}
-		emptyCexAssetListCommitment := utils.ComputeCexAssetsCommitment(emptyCexAssetsInfo)
-		expectFinalCexAssetsInfoComm := utils.ComputeCexAssetsCommitment(cexAssetsInfo)
-		prevCexAssetListCommitments[1] = emptyCexAssetListCommitment
-		var finalCexAssetsInfoComm []byte
-		var accountTreeRoot []byte
-		for i := 0; i < len(proofs); i++ {
-			if batchNumber != proofs[i].BatchNumber {
-				panic("the batch number is not monotonically increasing by 1")
-			}
-			// first deserialize proof
-			proof := groth16.NewProof(ecc.BN254)
-			var bufRaw bytes.Buffer
-			proofRaw, err := base64.StdEncoding.DecodeString(proofs[i].ZkProof)
-			if err != nil {
-				fmt.Println("decode proof failed:", batchNumber)
-				return
-			}
-			bufRaw.Write(proofRaw)
-			proof.ReadFrom(&bufRaw)
-			// deserialize cex asset list commitment and account tree root
-			cexAssetListCommitments := make([][]byte, 2)
-			accountTreeRoots := make([][]byte, 2)
-
-			for j := 0; j < len(proofs[i].CexAssetCommitment); j++ {
-				cexAssetListCommitments[j], err = base64.StdEncoding.DecodeString(proofs[i].CexAssetCommitment[j])
-				if err != nil {
-					fmt.Println("decode cex asset commitment failed")
-					panic(err.Error())
-				}
-			}
-			for j := 0; j < len(proofs[i].AccountTreeRoots); j++ {
-				accountTreeRoots[j], err = base64.StdEncoding.DecodeString(proofs[i].AccountTreeRoots[j])
-				if err != nil {
-					fmt.Println("decode account tree root failed")
-					panic(err.Error())
-				}
-			}
-
-			finalCexAssetsInfoComm = cexAssetListCommitments[1]
-			// verify the public input is correctly computed by cex asset list and account tree root
-			poseidonHasher := poseidon.NewPoseidon()
-			poseidonHasher.Write(accountTreeRoots[0])
-			poseidonHasher.Write(accountTreeRoots[1])
-			poseidonHasher.Write(cexAssetListCommitments[0])
-			poseidonHasher.Write(cexAssetListCommitments[1])
-			expectHash := poseidonHasher.Sum(nil)
-			actualHash, err := base64.StdEncoding.DecodeString(proofs[i].BatchCommitment)
-			if err != nil {
-				fmt.Println("decode batch commitment failed", batchNumber)
-				return
-			}
-			if string(expectHash) != string(actualHash) {
-				fmt.Println("public input verify failed ", batchNumber)
-				fmt.Printf("%x:%x\n", expectHash, actualHash)
-				return
-			}
-
-			if string(accountTreeRoots[0]) != string(prevAccountTreeRoots[1]) ||
-				string(cexAssetListCommitments[0]) != string(prevCexAssetListCommitments[1]) {
-				fmt.Println("mismatch account tree root or cex asset list commitment:", batchNumber)
-				return
-			}
-			prevCexAssetListCommitments = cexAssetListCommitments
-			prevAccountTreeRoots = accountTreeRoots
+		logx.Close()
+		os.Exit(verifier.VerifyExitCode(err))
+	}
+	code := verifyBatches(*bundleFlag, *publicKeyFlag, *unsignedFlag, *workersFlag, *checkpointFlag)
+	logx.Close()
+	os.Exit(code)
+}
 
-			verifyWitness := circuit.NewVerifyBatchCreateUserCircuit(actualHash)
-			vWitness, err := frontend.NewWitness(verifyWitness, ecc.BN254, frontend.PublicOnly())
-			if err != nil {
-				panic(err.Error())
-			}
-			err = groth16.Verify(proof, vk, vWitness)
+// verifyBatches verifies the batch proofs of the bundle, or of the config without it, and
+// returns the exit code of the report, see verifier.ExitCode.
+func verifyBatches(bundlePath string, publicKeyFlag string, unsigned bool, workers int, checkpointFile string) int {
+	verifierConfig := &config.Config{}
+	if bundlePath != "" {
+		var publicKey ed25519.PublicKey
+		var err error
+		if publicKeyFlag != "" {
+			publicKey, err = bundle.LoadPublicKey(publicKeyFlag)
 			if err != nil {
-				fmt.Println("proof verify failed:", batchNumber, err.Error())
-				return
-			} else {
-				fmt.Println("proof verify success", batchNumber)
+				fmt.Println(err)
+				return verifier.ExitError
 			}
-			batchNumber++
-			accountTreeRoot = accountTreeRoots[1]
-		}
-		if string(finalCexAssetsInfoComm) != string(expectFinalCexAssetsInfoComm) {
-			panic("Final Cex Assets Info Not Match")
+		} else if !unsigned {
+			fmt.Println("-public_key is required to check the bundle signature, or -unsigned to skip it")
+			return verifier.ExitError
 		}
-		fmt.Printf("account merkle tree root is %x\n", accountTreeRoot)
-		fmt.Println("All proofs verify passed!!!")
+		manifest, dir, cleanup, err := bundle.Open(bundlePath, publicKey)
+		if err != nil {
+			fmt.Println(err)
+			return verifier.ExitError
+		}
+		defer cleanup()
+		verifierConfig = manifest.VerifierConfig(dir, "")
+	} else if err := conf.Load("src/verifier/config/config.json", verifierConfig); err != nil {
+		fmt.Println(err)
+		return verifier.ExitError
+	}
+	if workers != 0 {
+		verifierConfig.Workers = workers
+	}
+	if checkpointFile != "" {
+		verifierConfig.CheckpointFile = checkpointFile
+	}
+	utils.SetupLogger("verifier", verifierConfig.Log)
+	report, err := verifier.VerifyBatches(verifierConfig)
+	if err != nil {
+		logx.Errorw("verify batches failed", logx.Field("error", err.Error()))
+	} else {
+		fmt.Println(report)
 	}
+	return verifier.ExitCode(report, err)
 }
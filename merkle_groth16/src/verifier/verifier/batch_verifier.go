@@ -0,0 +1,153 @@
+package verifier
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"merkleverifytool/merkle_groth16/circuit"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	progressInterval   = 10 * time.Second
+	checkpointInterval = 5 * time.Second
+)
+
+// batchProof is a batch whose chain linkage is checked and whose proof is to be verified.
+type batchProof struct {
+	batchNumber     int64
+	zkProof         string
+	batchCommitment []byte
+	zkKeyName       string
+	vk              groth16.VerifyingKey
+}
+
+type batchResult struct {
+	index     int // of the batch in the verified batches
+	malformed bool
+	err       error
+}
+
+// verify runs the pairing check of the proof of b against its batch commitment, a proof
+// which can't be decoded is malformed.
+func (b *batchProof) verify() (malformed bool, err error) {
+	proofRaw, err := base64.StdEncoding.DecodeString(b.zkProof)
+	if err != nil {
+		return true, fmt.Errorf("decode proof failed: %w", err)
+	}
+	proof := groth16.NewProof(ecc.BN254)
+	_, err = proof.ReadFrom(bytes.NewReader(proofRaw))
+	if err != nil {
+		return true, fmt.Errorf("read proof failed: %w", err)
+	}
+	verifyWitness := circuit.NewVerifyBatchCreateUserCircuit(b.batchCommitment)
+	vWitness, err := frontend.NewWitness(verifyWitness, ecc.BN254, frontend.PublicOnly())
+	if err != nil {
+		return true, err
+	}
+	return false, groth16.Verify(proof, b.vk, vWitness)
+}
+
+// verifyBatchProofs verifies the proofs of batches by workers in parallel, the cpu cores
+// if 0, skipping the batches verified by checkpoint which is saved into checkpointFile
+// as the batches are verified. The verified and failed batches are added to report.
+func verifyBatchProofs(batches []*batchProof, workers int, checkpointFile string, checkpoint *Checkpoint, report *Report) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	verified := int64(0)
+	if checkpoint != nil {
+		verified = checkpoint.VerifiedBatches
+	}
+	if verified > int64(len(batches)) {
+		verified = 0
+	}
+	total := int64(len(batches))
+	logx.Infow("verify batch proofs", logx.Field("batches", total), logx.Field("verified", verified),
+		logx.Field("workers", workers))
+
+	report.VerifiedBatches = int(verified)
+	jobs := make(chan int, workers)
+	results := make(chan batchResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				malformed, err := batches[index].verify()
+				results <- batchResult{index: index, malformed: malformed, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for index := int(verified); index < len(batches); index++ {
+			jobs <- index
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	saveCheckpoint := func() {
+		if checkpoint == nil {
+			return
+		}
+		checkpoint.VerifiedBatches = verified
+		err := checkpoint.Save(checkpointFile)
+		if err != nil {
+			logx.Errorw("save checkpoint failed", logx.Field("error", err.Error()))
+		}
+	}
+	// the proofs complete out of order, the checkpoint only covers the verified prefix
+	done := make(map[int64]bool)
+	start := time.Now()
+	startVerified := verified
+	lastProgress, lastCheckpoint := start, start
+	for result := range results {
+		batchNumber := batches[result.index].batchNumber
+		if result.err != nil {
+			logx.Errorw("proof verify failed", logx.Field("batchNumber", batchNumber), logx.Field("error", result.err.Error()))
+			batchError := BatchError{BatchNumber: batchNumber, Reason: result.err.Error()}
+			if result.malformed {
+				report.MalformedBatches = append(report.MalformedBatches, batchError)
+			} else {
+				report.InvalidBatches = append(report.InvalidBatches, batchError)
+			}
+			continue
+		}
+		logx.Debugw("proof verify success", logx.Field("batchNumber", batchNumber))
+		report.VerifiedBatches++
+		done[int64(result.index)] = true
+		for done[verified] {
+			delete(done, verified)
+			verified++
+		}
+		now := time.Now()
+		if now.Sub(lastCheckpoint) >= checkpointInterval {
+			saveCheckpoint()
+			lastCheckpoint = now
+		}
+		if now.Sub(lastProgress) >= progressInterval {
+			rate := float64(verified-startVerified) / now.Sub(start).Seconds()
+			fields := []logx.LogField{logx.Field("verified", verified), logx.Field("batches", total),
+				logx.Field("batchesPerSecond", rate)}
+			if rate > 0 {
+				fields = append(fields, logx.Field("eta", (time.Duration(float64(total-verified)/rate)*time.Second).String()))
+			}
+			logx.Infow("verify progress", fields...)
+			lastProgress = now
+		}
+	}
+	saveCheckpoint()
+}
@@ -0,0 +1,77 @@
+package verifier
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"merkleverifytool/merkle_groth16/src/bundle"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// Checkpoint records the batches verified by an interrupted verification, the first
+// VerifiedBatches well formed batches are skipped when the same proofs and keys are
+// verified again.
+type Checkpoint struct {
+	InputHash       string
+	VerifiedBatches int64
+}
+
+// ComputeInputHash hashes the proof table and the verifying key files of zkKeyNames, a
+// checkpoint can only be resumed with the same input.
+func ComputeInputHash(proofTable []byte, zkKeyNames []string) (string, error) {
+	names := append([]string{}, zkKeyNames...)
+	sort.Strings(names)
+	hasher := sha256.New()
+	hasher.Write([]byte(bundle.Sha256Hex(proofTable)))
+	for _, name := range names {
+		hash, err := bundle.HashVerifyingKey(name)
+		if err != nil {
+			return "", err
+		}
+		hasher.Write([]byte(name))
+		hasher.Write([]byte(hash))
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// LoadCheckpoint reads the checkpoint file path, a missing file or the checkpoint of
+// another input starts a new checkpoint of inputHash.
+func LoadCheckpoint(path string, inputHash string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{InputHash: inputHash}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	} else if err != nil {
+		return nil, err
+	}
+	saved := &Checkpoint{}
+	err = json.Unmarshal(content, saved)
+	if err != nil {
+		return nil, fmt.Errorf("parse checkpoint %s failed: %w", path, err)
+	}
+	if saved.InputHash != inputHash {
+		logx.Infow("the checkpoint is of other proofs or keys, verify from the first batch", logx.Field("file", path))
+		return checkpoint, nil
+	}
+	logx.Infow("resume from checkpoint", logx.Field("file", path), logx.Field("verifiedBatches", saved.VerifiedBatches))
+	return saved, nil
+}
+
+// Save writes the checkpoint into the file path, replacing it atomically.
+func (c *Checkpoint) Save(path string) error {
+	content, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path+".tmp", content, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
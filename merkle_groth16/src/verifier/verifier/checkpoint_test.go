@@ -0,0 +1,60 @@
+package verifier
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	zkKeyName := filepath.Join(dir, "zkpor500")
+	err := ioutil.WriteFile(zkKeyName+".vk.save", []byte("vk"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputHash, err := ComputeInputHash([]byte("proofs"), []string{zkKeyName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "checkpoint.json")
+	checkpoint, err := LoadCheckpoint(path, inputHash)
+	if err != nil || checkpoint.VerifiedBatches != 0 {
+		t.Fatalf("unexpected new checkpoint %+v, %v", checkpoint, err)
+	}
+	checkpoint.VerifiedBatches = 3
+	err = checkpoint.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err = LoadCheckpoint(path, inputHash)
+	if err != nil || checkpoint.VerifiedBatches != 3 {
+		t.Fatalf("the checkpoint is not resumed: %+v, %v", checkpoint, err)
+	}
+
+	// the verified batches are skipped
+	batches := []*batchProof{{batchNumber: 0}, {batchNumber: 1}, {batchNumber: 2}}
+	report := &Report{}
+	verifyBatchProofs(batches, 2, path, checkpoint, report)
+	if report.VerifiedBatches != 3 || len(report.MalformedBatches) > 0 {
+		t.Fatalf("the verified batches are verified again: %+v", report)
+	}
+	// a changed key starts from the first batch
+	err = ioutil.WriteFile(zkKeyName+".vk.save", []byte("other vk"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherHash, err := ComputeInputHash([]byte("proofs"), []string{zkKeyName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err = LoadCheckpoint(path, otherHash)
+	if err != nil || checkpoint.VerifiedBatches != 0 {
+		t.Fatalf("the checkpoint of another key is resumed: %+v, %v", checkpoint, err)
+	}
+	report = &Report{}
+	verifyBatchProofs(batches, 2, path, checkpoint, report)
+	if report.VerifiedBatches != 0 || len(report.MalformedBatches) != 3 {
+		t.Fatalf("invalid proofs pass: %+v", report)
+	}
+}
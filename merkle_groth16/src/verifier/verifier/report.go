@@ -0,0 +1,107 @@
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// exit codes of the batch verification in the CLIs, a report of several kinds of failed
+// batches exits with the code of the most severe one
+const (
+	ExitPassed     = 0
+	ExitError      = 1 // the verification couldn't run, e.g. a missing key or proof table
+	ExitIncomplete = 2 // missing or duplicate batches
+	ExitMalformed  = 3 // batches which can't be decoded
+	ExitInvalid    = 4 // batches or final cex assets and account tree root which don't verify
+)
+
+// ErrInvalid is wrapped by the errors of VerifyCexSummary and VerifyUser for proofs which
+// don't verify or don't match the config, other errors are bad input.
+var ErrInvalid = errors.New("verification failed")
+
+// VerifyExitCode is the exit code of the error of VerifyCexSummary or VerifyUser.
+func VerifyExitCode(err error) int {
+	if err == nil {
+		return ExitPassed
+	}
+	if errors.Is(err, ErrInvalid) {
+		return ExitInvalid
+	}
+	return ExitError
+}
+
+// BatchError is a batch which failed the verification and why.
+type BatchError struct {
+	BatchNumber int64
+	Reason      string
+}
+
+// Report is the outcome of the verification of a proof table by VerifyBatches.
+type Report struct {
+	Proofs                  int     // rows of the proof table
+	VerifiedBatches         int     // batches whose proof passed the pairing check
+	MissingBatches          []int64 // batch numbers below the last one without proof
+	DuplicateBatches        []int64 // batch numbers of more than one proof, the first one is verified
+	MalformedBatches        []BatchError
+	InvalidBatches          []BatchError
+	CexAssetsMismatch       bool   // the last batch doesn't commit to the cex assets of the config
+	AccountTreeRootMismatch bool   // the last batch doesn't end with the account tree root of the config
+	AccountTreeRoot         string // hex of the account tree root after the last batch
+}
+
+// Passed reports whether every batch is present once, well formed and verified and the
+// last one matches the expected cex assets and account tree root.
+func (r *Report) Passed() bool {
+	return r.exitCode() == ExitPassed
+}
+
+func (r *Report) exitCode() int {
+	switch {
+	case len(r.InvalidBatches) > 0 || r.CexAssetsMismatch || r.AccountTreeRootMismatch:
+		return ExitInvalid
+	case len(r.MalformedBatches) > 0:
+		return ExitMalformed
+	case len(r.MissingBatches) > 0 || len(r.DuplicateBatches) > 0 || r.Proofs == 0:
+		return ExitIncomplete
+	}
+	return ExitPassed
+}
+
+// String summarizes the failures of the report.
+func (r *Report) String() string {
+	if r.Passed() {
+		return fmt.Sprintf("all %d batches verified", r.VerifiedBatches)
+	}
+	var failures []string
+	if r.Proofs == 0 {
+		failures = append(failures, "no proofs")
+	}
+	if len(r.MissingBatches) > 0 {
+		failures = append(failures, fmt.Sprintf("missing batches %v", r.MissingBatches))
+	}
+	if len(r.DuplicateBatches) > 0 {
+		failures = append(failures, fmt.Sprintf("duplicate batches %v", r.DuplicateBatches))
+	}
+	for _, e := range r.MalformedBatches {
+		failures = append(failures, fmt.Sprintf("malformed batch %d: %s", e.BatchNumber, e.Reason))
+	}
+	for _, e := range r.InvalidBatches {
+		failures = append(failures, fmt.Sprintf("invalid batch %d: %s", e.BatchNumber, e.Reason))
+	}
+	if r.CexAssetsMismatch {
+		failures = append(failures, "final cex assets mismatch")
+	}
+	if r.AccountTreeRootMismatch {
+		failures = append(failures, "final account tree root mismatch")
+	}
+	return strings.Join(failures, "; ")
+}
+
+// ExitCode maps the result of VerifyBatches to the exit code of the CLIs.
+func ExitCode(report *Report, err error) int {
+	if err != nil || report == nil {
+		return ExitError
+	}
+	return report.exitCode()
+}
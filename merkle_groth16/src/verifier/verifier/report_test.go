@@ -0,0 +1,114 @@
+package verifier
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"merkleverifytool/merkle_groth16/src/prover/prover"
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/verifier/config"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/poseidon"
+)
+
+func TestCheckBatchChain(t *testing.T) {
+	verifierConfig := &config.Config{
+		CexAssetsInfo:  []utils.CexAssetInfo{{Symbol: "btc", Index: 0, TotalBalance: 5, BasePrice: 1}},
+		CexTotalEquity: 5,
+	}
+	emptyRoot := utils.EmptyAccountTreeRoot
+	emptyComm := utils.ComputeCexAssetsCommitment([]utils.CexAssetInfo{{Symbol: "btc", Index: 0, BasePrice: 1}}, 0, 0)
+	finalComm := utils.ComputeCexAssetsCommitment(verifierConfig.CexAssetsInfo, 5, 0)
+	roots := [][]byte{emptyRoot, []byte("root1"), []byte("root2"), []byte("root3")}
+	comms := [][]byte{emptyComm, []byte("comm1"), []byte("comm2"), finalComm}
+	newProof := func(batchNumber int64) *Proof {
+		hasher := poseidon.NewPoseidon()
+		hasher.Write(roots[batchNumber])
+		hasher.Write(roots[batchNumber+1])
+		hasher.Write(comms[batchNumber])
+		hasher.Write(comms[batchNumber+1])
+		encode := base64.StdEncoding.EncodeToString
+		return &Proof{
+			BatchNumber:        batchNumber,
+			CexAssetCommitment: []string{encode(comms[batchNumber]), encode(comms[batchNumber+1])},
+			AccountTreeRoots:   []string{encode(roots[batchNumber]), encode(roots[batchNumber+1])},
+			BatchCommitment:    encode(hasher.Sum(nil)),
+		}
+	}
+
+	report := &Report{}
+	batches, err := checkBatchChain(verifierConfig, []*Proof{newProof(2), newProof(0), newProof(1)}, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || batches[0].batchNumber != 0 || batches[2].batchNumber != 2 ||
+		len(report.InvalidBatches) > 0 || report.CexAssetsMismatch || report.AccountTreeRoot != hex.EncodeToString(roots[3]) {
+		t.Fatalf("unexpected chain check of valid batches: %d batches, %+v", len(batches), report)
+	}
+
+	// batch 1 is missing, batch 0 is duplicate and batch 2 is malformed
+	malformed := newProof(2)
+	malformed.BatchCommitment = "not base64"
+	report = &Report{Proofs: 3}
+	batches, err = checkBatchChain(verifierConfig, []*Proof{newProof(0), newProof(0), malformed}, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 1 || !reflect.DeepEqual(report.MissingBatches, []int64{1}) ||
+		!reflect.DeepEqual(report.DuplicateBatches, []int64{0}) ||
+		len(report.MalformedBatches) != 1 || report.MalformedBatches[0].BatchNumber != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if ExitCode(report, nil) != ExitMalformed {
+		t.Fatalf("exit code %d of %s", ExitCode(report, nil), report)
+	}
+
+	// batch 1 doesn't start from the root of batch 0 and the final cex assets differ
+	roots[1] = []byte("other")
+	broken := newProof(1)
+	roots[1] = []byte("root1")
+	verifierConfig.CexTotalEquity = 6
+	report = &Report{Proofs: 2}
+	_, err = checkBatchChain(verifierConfig, []*Proof{newProof(0), broken}, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.InvalidBatches) != 1 || report.InvalidBatches[0].BatchNumber != 1 || !report.CexAssetsMismatch {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if ExitCode(report, nil) != ExitInvalid || ExitCode(&Report{Proofs: 1, VerifiedBatches: 1}, nil) != ExitPassed {
+		t.Fatalf("exit code %d of %s", ExitCode(report, nil), report)
+	}
+}
+
+func TestCheckCexSummaryTotals(t *testing.T) {
+	verifierConfig := &config.Config{
+		CexAssetsInfo:  []utils.CexAssetInfo{{Symbol: "btc", Index: 1, TotalBalance: -5, BasePrice: 3}},
+		CexTotalEquity: 7,
+		CexTotalDebt:   2,
+	}
+	summaryProof := &prover.CexSummaryProof{
+		TotalEquity:   7,
+		TotalDebt:     2,
+		CexAssetsInfo: []utils.CexAssetInfo{{Symbol: "eth", Index: 0, BasePrice: 1}, {Symbol: "btc", Index: 1, TotalBalance: -5, BasePrice: 3}},
+	}
+	err := checkCexSummaryTotals(verifierConfig, summaryProof)
+	if err != nil || VerifyExitCode(err) != ExitPassed {
+		t.Fatal(err)
+	}
+
+	summaryProof.TotalDebt = 1
+	err = checkCexSummaryTotals(verifierConfig, summaryProof)
+	if VerifyExitCode(err) != ExitInvalid {
+		t.Fatalf("understated debt: %v", err)
+	}
+
+	summaryProof.TotalDebt = 2
+	summaryProof.CexAssetsInfo[1].TotalBalance = 5
+	err = checkCexSummaryTotals(verifierConfig, summaryProof)
+	if VerifyExitCode(err) != ExitInvalid {
+		t.Fatalf("flipped asset balance: %v", err)
+	}
+}
@@ -0,0 +1,415 @@
+package verifier
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"merkleverifytool/merkle_groth16/src/bundle"
+	"merkleverifytool/merkle_groth16/src/prover/prover"
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/verifier/config"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr/poseidon"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// Proof is a row of the proof table.
+type Proof = bundle.Proof
+
+// VerifyCexSummary verifies the cex summary proof of verifierConfig, that it is built on the
+// last batch proof of the proof table and that its totals are the cex assets and totals of
+// verifierConfig. The error wraps ErrInvalid if the proof doesn't verify or match.
+func VerifyCexSummary(verifierConfig *config.Config) error {
+	content, err := ioutil.ReadFile(verifierConfig.SummaryProofFile)
+	if err != nil {
+		return err
+	}
+	summaryProof := &prover.CexSummaryProof{}
+	err = json.Unmarshal(content, summaryProof)
+	if err != nil {
+		return fmt.Errorf("decode summary proof %s failed: %w", verifierConfig.SummaryProofFile, err)
+	}
+	vk, err := prover.LoadVerifyingKey(verifierConfig.SummaryZkKeyName)
+	if err != nil {
+		return err
+	}
+	proof := groth16.NewProof(ecc.BN254)
+	proofRaw, err := base64.StdEncoding.DecodeString(summaryProof.ProofInfo)
+	if err != nil {
+		return fmt.Errorf("decode summary proof failed: %w", err)
+	}
+	_, err = proof.ReadFrom(bytes.NewReader(proofRaw))
+	if err != nil {
+		return fmt.Errorf("decode summary proof failed: %w", err)
+	}
+
+	// the summary proof must be built on the last batch proof
+	proofs, err := bundle.ReadProofs(verifierConfig.ProofTable)
+	if err != nil {
+		return err
+	}
+	var lastProof *Proof
+	for i := 0; i < len(proofs); i++ {
+		if lastProof == nil || proofs[i].BatchNumber > lastProof.BatchNumber {
+			lastProof = proofs[i]
+		}
+	}
+	if lastProof == nil || lastProof.BatchNumber != summaryProof.BatchNumber ||
+		lastProof.BatchCommitment != summaryProof.BatchCommitment {
+		return fmt.Errorf("%w: the summary proof does not match the last batch proof", ErrInvalid)
+	}
+
+	verifyWitness, err := summaryProof.NewVerifyCexSummaryCircuit()
+	if err != nil {
+		return err
+	}
+	vWitness, err := frontend.NewWitness(verifyWitness, ecc.BN254, frontend.PublicOnly())
+	if err != nil {
+		return err
+	}
+	err = groth16.Verify(proof, vk, vWitness)
+	if err != nil {
+		return fmt.Errorf("%w: summary proof: %s", ErrInvalid, err.Error())
+	}
+	err = checkCexSummaryTotals(verifierConfig, summaryProof)
+	if err != nil {
+		return err
+	}
+	logx.Infow("cex totals", logx.Field("totalEquity", summaryProof.TotalEquity), logx.Field("totalDebt", summaryProof.TotalDebt))
+	for i := 0; i < len(summaryProof.CexAssetsInfo); i++ {
+		if summaryProof.CexAssetsInfo[i].TotalBalance == 0 {
+			continue
+		}
+		logx.Infow("cex asset", logx.Field("symbol", summaryProof.CexAssetsInfo[i].Symbol),
+			logx.Field("totalBalance", summaryProof.CexAssetsInfo[i].TotalBalance),
+			logx.Field("basePrice", summaryProof.CexAssetsInfo[i].BasePrice))
+	}
+	logx.Info("summary proof verify passed!!!")
+	return nil
+}
+
+// checkCexSummaryTotals checks the proven totals of summaryProof against the published cex
+// totals and assets of verifierConfig.
+func checkCexSummaryTotals(verifierConfig *config.Config, summaryProof *prover.CexSummaryProof) error {
+	if summaryProof.TotalEquity != verifierConfig.CexTotalEquity || summaryProof.TotalDebt != verifierConfig.CexTotalDebt {
+		return fmt.Errorf("%w: proven total equity %d and debt %d differ from the published %d and %d", ErrInvalid,
+			summaryProof.TotalEquity, summaryProof.TotalDebt, verifierConfig.CexTotalEquity, verifierConfig.CexTotalDebt)
+	}
+	proven := make(map[uint32]utils.CexAssetInfo, len(summaryProof.CexAssetsInfo))
+	for _, asset := range summaryProof.CexAssetsInfo {
+		proven[asset.Index] = asset
+	}
+	for _, asset := range verifierConfig.CexAssetsInfo {
+		if p := proven[asset.Index]; p.TotalBalance != asset.TotalBalance || p.BasePrice != asset.BasePrice {
+			return fmt.Errorf("%w: proven balance %d and price %d of asset %s differ from the published %d and %d", ErrInvalid,
+				p.TotalBalance, p.BasePrice, asset.Symbol, asset.TotalBalance, asset.BasePrice)
+		}
+	}
+	return nil
+}
+
+// VerifyUser verifies the merkle proof of the user proof userConfig against its root. The
+// error wraps ErrInvalid if the account isn't in the tree.
+func VerifyUser(userConfig *config.UserConfig) error {
+	root, err := hex.DecodeString(userConfig.Root)
+	if err != nil || len(root) != 32 {
+		return errors.New("invalid account tree root")
+	}
+
+	var proof [][]byte
+	for i := 0; i < len(userConfig.Proof); i++ {
+		p, err := base64.StdEncoding.DecodeString(userConfig.Proof[i])
+		if err != nil || len(p) != 32 {
+			return errors.New("invalid proof")
+		}
+		proof = append(proof, p)
+	}
+
+	// the assets are the asset slots committed in the leaf, including zero-balance ones
+	hasher := poseidon.NewPoseidon()
+	assetCommitment := utils.ComputeUserAssetsCommitment(&hasher, userConfig.Assets)
+	hasher.Reset()
+	// compute new account leaf node hash
+	accountIdHash, err := hex.DecodeString(userConfig.AccountIdHash)
+	if err != nil || len(accountIdHash) != 32 {
+		return errors.New("the AccountIdHash is invalid")
+	}
+	accountHash := poseidon.PoseidonBytes(accountIdHash, userConfig.TotalEquity.Bytes(), userConfig.TotalDebt.Bytes(), assetCommitment)
+	logx.Infow("merkle leave hash", logx.Field("accountIndex", userConfig.AccountIndex), logx.Field("hash", hex.EncodeToString(accountHash)))
+	verifyFlag := utils.VerifyMerkleProof(root, userConfig.AccountIndex, proof, accountHash)
+	if !verifyFlag {
+		logx.Errorw("verify failed...", logx.Field("accountIndex", userConfig.AccountIndex))
+		return fmt.Errorf("%w: account %d is not in the account tree %s", ErrInvalid, userConfig.AccountIndex, userConfig.Root)
+	}
+	logx.Infow("verify pass!!!", logx.Field("accountIndex", userConfig.AccountIndex))
+	return nil
+}
+
+// VerifyBatches verifies the batch proofs of the proof table of verifierConfig, their chain
+// of account tree roots and cex asset commitments and the final cex assets. The chain is
+// checked sequentially first, then the proofs are verified by verifierConfig.Workers in
+// parallel, resuming from verifierConfig.CheckpointFile if set. The failed batches are
+// reported, an error is only returned if the verification can't run.
+func VerifyBatches(verifierConfig *config.Config) (*Report, error) {
+	// every batch is verified with the key of its batch size and user asset counts tier,
+	// rows without ZkKeyName use the one of the config
+	zkKeyNames := make(map[string]bool)
+	for _, batchCounts := range utils.BatchCreateUserOpsCountsTiers {
+		for _, userAssetCounts := range utils.UserAssetCountsTiers {
+			zkKeyNames[utils.GetZkKeyName(verifierConfig.ZkKeyName, batchCounts, userAssetCounts)] = true
+		}
+	}
+	vks := make(map[string]groth16.VerifyingKey)
+	loadVerifyingKey := func(zkKeyName string) (groth16.VerifyingKey, error) {
+		if vk, ok := vks[zkKeyName]; ok {
+			return vk, nil
+		}
+		if hash, ok := verifierConfig.VerifyingKeyHashes[filepath.Base(zkKeyName)]; ok {
+			actual, err := bundle.HashVerifyingKey(zkKeyName)
+			if err != nil {
+				return nil, err
+			}
+			if actual != hash {
+				return nil, fmt.Errorf("verifying key %s doesn't match the hash of the bundle", zkKeyName)
+			}
+		} else if len(verifierConfig.VerifyingKeyHashes) > 0 {
+			return nil, fmt.Errorf("verifying key %s is not in the bundle", zkKeyName)
+		}
+		vk, err := prover.LoadVerifyingKey(zkKeyName)
+		if err != nil {
+			return nil, err
+		}
+		vks[zkKeyName] = vk
+		return vk, nil
+	}
+
+	proofTable, err := ioutil.ReadFile(verifierConfig.ProofTable)
+	if err != nil {
+		return nil, err
+	}
+	proofs, err := bundle.ReadProofs(verifierConfig.ProofTable)
+	if err != nil {
+		return nil, err
+	}
+	logx.Infow("proofs loaded", logx.Field("proofs", len(proofs)))
+	report := &Report{Proofs: len(proofs)}
+	batches, err := checkBatchChain(verifierConfig, proofs, report)
+	if err != nil {
+		return nil, err
+	}
+
+	// the keys are loaded before the workers share them
+	var usedZkKeyNames []string
+	verifiable := batches[:0]
+	for _, batch := range batches {
+		if batch.zkKeyName == "" {
+			batch.zkKeyName = verifierConfig.ZkKeyName
+		} else if filepath.Dir(batch.zkKeyName) == "." {
+			// the base names of a bundle are in the key directory of the config
+			batch.zkKeyName = filepath.Join(filepath.Dir(verifierConfig.ZkKeyName), batch.zkKeyName)
+		}
+		if !zkKeyNames[batch.zkKeyName] {
+			report.MalformedBatches = append(report.MalformedBatches,
+				BatchError{BatchNumber: batch.batchNumber, Reason: "unknown zk key name " + batch.zkKeyName})
+			continue
+		}
+		if _, ok := vks[batch.zkKeyName]; !ok {
+			usedZkKeyNames = append(usedZkKeyNames, batch.zkKeyName)
+		}
+		batch.vk, err = loadVerifyingKey(batch.zkKeyName)
+		if err != nil {
+			return nil, err
+		}
+		verifiable = append(verifiable, batch)
+	}
+
+	var checkpoint *Checkpoint
+	if verifierConfig.CheckpointFile != "" {
+		inputHash, err := ComputeInputHash(proofTable, usedZkKeyNames)
+		if err != nil {
+			return nil, err
+		}
+		checkpoint, err = LoadCheckpoint(verifierConfig.CheckpointFile, inputHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	verifyBatchProofs(verifiable, verifierConfig.Workers, verifierConfig.CheckpointFile, checkpoint, report)
+	sortBatchErrors(report.MalformedBatches)
+	sortBatchErrors(report.InvalidBatches)
+	if !report.Passed() {
+		logx.Errorw("proofs verify failed", logx.Field("report", report.String()))
+		return report, nil
+	}
+	if verifierConfig.CheckpointFile != "" {
+		err = os.Remove(verifierConfig.CheckpointFile)
+		if err != nil && !os.IsNotExist(err) {
+			logx.Errorw("remove checkpoint failed", logx.Field("error", err.Error()))
+		}
+	}
+	logx.Infow("All proofs verify passed!!!", logx.Field("accountTreeRoot", report.AccountTreeRoot))
+	return report, nil
+}
+
+// checkBatchChain reports the missing, duplicate and malformed batches of proofs, and the
+// batches which don't start from the account tree root and cex asset commitment the
+// previous batch ended with or whose public input doesn't commit to them, and whether the
+// last batch ends with the cex assets and account tree root of verifierConfig. It returns
+// the well formed batches to verify, ordered by batch number.
+func checkBatchChain(verifierConfig *config.Config, proofs []*Proof, report *Report) ([]*batchProof, error) {
+	// according to asset price info to compute
+	cexAssetsInfo := make([]utils.CexAssetInfo, len(verifierConfig.CexAssetsInfo))
+	for i := 0; i < len(verifierConfig.CexAssetsInfo); i++ {
+		index := verifierConfig.CexAssetsInfo[i].Index
+		if int(index) >= len(cexAssetsInfo) {
+			return nil, fmt.Errorf("cex asset %s has index %d out of %d assets", verifierConfig.CexAssetsInfo[i].Symbol, index, len(cexAssetsInfo))
+		}
+		cexAssetsInfo[index] = verifierConfig.CexAssetsInfo[i]
+	}
+	emptyCexAssetsInfo := make([]utils.CexAssetInfo, len(cexAssetsInfo))
+	copy(emptyCexAssetsInfo, cexAssetsInfo)
+	for i := 0; i < len(emptyCexAssetsInfo); i++ {
+		emptyCexAssetsInfo[i].TotalBalance = 0
+	}
+	emptyCexAssetListCommitment := utils.ComputeCexAssetsCommitment(emptyCexAssetsInfo, 0, 0)
+	expectFinalCexAssetsInfoComm := utils.ComputeCexAssetsCommitment(cexAssetsInfo, verifierConfig.CexTotalEquity, verifierConfig.CexTotalDebt)
+
+	// order the proofs by batch number, the first proof of a batch number is kept
+	byNumber := make(map[int64]*Proof, len(proofs))
+	duplicates := make(map[int64]bool)
+	var numbers []int64
+	for _, proof := range proofs {
+		if proof.BatchNumber < 0 {
+			report.MalformedBatches = append(report.MalformedBatches,
+				BatchError{BatchNumber: proof.BatchNumber, Reason: "negative batch number"})
+			continue
+		}
+		if _, ok := byNumber[proof.BatchNumber]; ok {
+			logx.Errorw("duplicate batch", logx.Field("batchNumber", proof.BatchNumber))
+			if !duplicates[proof.BatchNumber] {
+				duplicates[proof.BatchNumber] = true
+				report.DuplicateBatches = append(report.DuplicateBatches, proof.BatchNumber)
+			}
+			continue
+		}
+		byNumber[proof.BatchNumber] = proof
+		numbers = append(numbers, proof.BatchNumber)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	sort.Slice(report.DuplicateBatches, func(i, j int) bool { return report.DuplicateBatches[i] < report.DuplicateBatches[j] })
+
+	malformed := func(batchNumber int64, reason string) {
+		logx.Errorw("malformed batch", logx.Field("batchNumber", batchNumber), logx.Field("reason", reason))
+		report.MalformedBatches = append(report.MalformedBatches, BatchError{BatchNumber: batchNumber, Reason: reason})
+	}
+	invalid := func(batchNumber int64, reason string) {
+		logx.Errorw("invalid batch", logx.Field("batchNumber", batchNumber), logx.Field("reason", reason))
+		report.InvalidBatches = append(report.InvalidBatches, BatchError{BatchNumber: batchNumber, Reason: reason})
+	}
+	decode := func(values []string) ([][]byte, error) {
+		if len(values) != 2 {
+			return nil, fmt.Errorf("%d values instead of 2", len(values))
+		}
+		decoded := make([][]byte, 2)
+		for j := 0; j < 2; j++ {
+			value, err := base64.StdEncoding.DecodeString(values[j])
+			if err != nil {
+				return nil, err
+			}
+			decoded[j] = value
+		}
+		return decoded, nil
+	}
+
+	// the commitment and root the next batch starts from, nil if they are unknown because
+	// the previous batch is missing or malformed
+	prevCexAssetListCommitment := emptyCexAssetListCommitment
+	prevAccountTreeRoot := utils.EmptyAccountTreeRoot
+	var finalCexAssetsInfoComm []byte
+	var accountTreeRoot []byte
+	batches := make([]*batchProof, 0, len(numbers))
+	expectedNumber := int64(0)
+	for _, batchNumber := range numbers {
+		for ; expectedNumber < batchNumber; expectedNumber++ {
+			report.MissingBatches = append(report.MissingBatches, expectedNumber)
+			prevCexAssetListCommitment, prevAccountTreeRoot = nil, nil
+		}
+		expectedNumber = batchNumber + 1
+		proof := byNumber[batchNumber]
+		finalCexAssetsInfoComm, accountTreeRoot = nil, nil
+
+		cexAssetListCommitments, err := decode(proof.CexAssetCommitment)
+		if err != nil {
+			malformed(batchNumber, "decode cex asset commitments failed: "+err.Error())
+			prevCexAssetListCommitment, prevAccountTreeRoot = nil, nil
+			continue
+		}
+		accountTreeRoots, err := decode(proof.AccountTreeRoots)
+		if err != nil {
+			malformed(batchNumber, "decode account tree roots failed: "+err.Error())
+			prevCexAssetListCommitment, prevAccountTreeRoot = nil, nil
+			continue
+		}
+		actualHash, err := base64.StdEncoding.DecodeString(proof.BatchCommitment)
+		if err != nil {
+			malformed(batchNumber, "decode batch commitment failed: "+err.Error())
+			prevCexAssetListCommitment, prevAccountTreeRoot = nil, nil
+			continue
+		}
+
+		// verify the public input is correctly computed by cex asset list and account tree root
+		poseidonHasher := poseidon.NewPoseidon()
+		poseidonHasher.Write(accountTreeRoots[0])
+		poseidonHasher.Write(accountTreeRoots[1])
+		poseidonHasher.Write(cexAssetListCommitments[0])
+		poseidonHasher.Write(cexAssetListCommitments[1])
+		expectHash := poseidonHasher.Sum(nil)
+		if string(expectHash) != string(actualHash) {
+			invalid(batchNumber, fmt.Sprintf("public input %s, expected %s", hex.EncodeToString(actualHash), hex.EncodeToString(expectHash)))
+		} else if prevAccountTreeRoot != nil &&
+			(string(accountTreeRoots[0]) != string(prevAccountTreeRoot) ||
+				string(cexAssetListCommitments[0]) != string(prevCexAssetListCommitment)) {
+			invalid(batchNumber, "mismatch account tree root or cex asset list commitment")
+		}
+		prevCexAssetListCommitment = cexAssetListCommitments[1]
+		prevAccountTreeRoot = accountTreeRoots[1]
+		finalCexAssetsInfoComm = cexAssetListCommitments[1]
+		accountTreeRoot = accountTreeRoots[1]
+
+		batches = append(batches, &batchProof{
+			batchNumber:     batchNumber,
+			zkProof:         proof.ZkProof,
+			batchCommitment: actualHash,
+			zkKeyName:       proof.ZkKeyName,
+		})
+	}
+
+	// the final checks need a well formed last batch, else the batch is already reported
+	if accountTreeRoot != nil {
+		report.AccountTreeRoot = hex.EncodeToString(accountTreeRoot)
+		if string(finalCexAssetsInfoComm) != string(expectFinalCexAssetsInfoComm) {
+			logx.Error("Final Cex Assets Info Not Match")
+			report.CexAssetsMismatch = true
+		}
+		if verifierConfig.AccountTreeRoot != "" && report.AccountTreeRoot != verifierConfig.AccountTreeRoot {
+			logx.Error("Final Account Tree Root Not Match")
+			report.AccountTreeRootMismatch = true
+		}
+	}
+	logx.Infow("batch chain check finished", logx.Field("batches", len(numbers)))
+	return batches, nil
+}
+
+func sortBatchErrors(errs []BatchError) {
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].BatchNumber < errs[j].BatchNumber })
+}
@@ -1,47 +1,32 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
-	"fmt"
-	"io/ioutil"
+	"os/signal"
+	"syscall"
 
+	"merkleverifytool/merkle_groth16/src/conf"
 	"merkleverifytool/merkle_groth16/src/utils"
 	"merkleverifytool/merkle_groth16/src/witness/config"
 	"merkleverifytool/merkle_groth16/src/witness/witness"
 )
 
 func main() {
-	remotePasswdConfig := flag.String("remote_password_config", "", "fetch password from aws secretsmanager")
+	defer utils.LogPanic()
+	remotePasswdConfig := flag.String("remote_password_config", "", "mysql password secret: env:NAME, file:PATH, vault:PATH#KEY, aws:SECRET_ID?region=REGION#KEY or an aws secret id")
 	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	witnessConfig := &config.Config{} // witness/config/config.go
-	content, err := ioutil.ReadFile("src/witness/config/config.json")
-	if err != nil {
-		panic(err.Error())
-	}
-	err = json.Unmarshal(content, witnessConfig)
-	if err != nil {
-		panic(err.Error())
-	}
+	conf.MustLoad("src/witness/config/config.json", witnessConfig)
+	utils.SetupLogger("witness", witnessConfig.Log)
 	if *remotePasswdConfig != "" {
-		s, err := utils.GetMysqlSource(witnessConfig.MysqlDataSource, *remotePasswdConfig)
+		s, err := utils.GetDataSource(witnessConfig.DbDriver, witnessConfig.MysqlDataSource, *remotePasswdConfig)
 		if err != nil {
 			panic(err.Error())
 		}
 		witnessConfig.MysqlDataSource = s
 	}
-	accounts, cexAssetsInfo, err := utils.ParseUserDataSet(witnessConfig.UserDataFile)
-	fmt.Println("account counts", len(accounts))
-	if err != nil {
-		panic(err.Error())
-	}
-	accountTree, err := utils.NewAccountTree(witnessConfig.TreeDB.Driver, witnessConfig.TreeDB.Option.Addr)
-	if err != nil {
-		panic(err.Error())
-	}
-	fmt.Println("account tree init height is ", accountTree.LatestVersion())
-	fmt.Printf("account tree root is %x\n", accountTree.Root())
-	witnessService := witness.NewWitness(accountTree, uint32(len(accounts)), accounts, cexAssetsInfo, witnessConfig)
-	witnessService.Run()
-	fmt.Println("witness service run finished...")
+	witness.RunService(ctx, witnessConfig)
 }
@@ -0,0 +1,101 @@
+package witness
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// ComputeInputHash hashes the arranged accounts and the asset prices, the batches of a
+// checkpoint can only be continued with the same input.
+func ComputeInputHash(accounts []utils.AccountInfo, cexAssets []utils.CexAssetInfo) string {
+	hasher := sha256.New()
+	buf := make([]byte, 8)
+	writeUint64 := func(v uint64) {
+		binary.BigEndian.PutUint64(buf, v)
+		hasher.Write(buf)
+	}
+	writeBytes := func(b []byte) {
+		writeUint64(uint64(len(b)))
+		hasher.Write(b)
+	}
+	writeUint64(uint64(len(cexAssets)))
+	for i := 0; i < len(cexAssets); i++ {
+		writeUint64(uint64(cexAssets[i].Index))
+		writeUint64(cexAssets[i].BasePrice)
+		writeBytes([]byte(cexAssets[i].Symbol))
+	}
+	writeUint64(uint64(len(accounts)))
+	for i := 0; i < len(accounts); i++ {
+		writeUint64(uint64(accounts[i].AccountIndex))
+		writeBytes(accounts[i].AccountId)
+		writeBytes(accounts[i].TotalEquity.Bytes())
+		writeBytes(accounts[i].TotalDebt.Bytes())
+		writeUint64(uint64(len(accounts[i].Assets)))
+		for j := 0; j < len(accounts[i].Assets); j++ {
+			writeUint64(uint64(accounts[i].Assets[j].Index))
+			writeUint64(uint64(accounts[i].Assets[j].Balance))
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// CheckConsistency checks the account tree and the checkpoint against the batch witness
+// of height, the latest one in db. A tree ahead of the db, left by a crash between the tree
+// commit and the db write, is rolled back to the checkpoint, every other mismatch panics.
+// A db written before checkpoints were introduced gets a checkpoint of its latest batch.
+func (w *Witness) CheckConsistency(height int64, latestWitness *BatchWitness) {
+	checkpoint, err := w.witnessModel.GetLatestCheckpoint()
+	if err != nil && err != utils.DbErrNotFound {
+		panic(err.Error())
+	}
+	if err == utils.DbErrNotFound && height >= 0 {
+		logx.Infow("there is no checkpoint, create it from batch witness", logx.Field("height", height))
+		checkpoint = &Checkpoint{
+			Height:      height,
+			TreeVersion: height + 1,
+			TreeRoot:    hex.EncodeToString(utils.DecodeBatchWitness(latestWitness.WitnessData).AfterAccountTreeRoot),
+			InputHash:   w.inputHash,
+		}
+		err = w.witnessModel.CreateCheckpoint(checkpoint)
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+	if checkpoint != nil {
+		if checkpoint.Height != height {
+			panic(fmt.Sprintf("checkpoint height %d doesn't match witness height %d", checkpoint.Height, height))
+		}
+		if checkpoint.InputHash != w.inputHash {
+			panic("the input data differs from the one of the checkpoint")
+		}
+	}
+
+	// the tree version is height+1 after the batch witness of height
+	treeVersion := bsmt.Version(height + 1)
+	if checkpoint != nil {
+		treeVersion = bsmt.Version(checkpoint.TreeVersion)
+	}
+	if w.accountTree.LatestVersion() > treeVersion {
+		err = w.accountTree.Rollback(treeVersion)
+		if err != nil {
+			logx.Errorw("rollback failed", logx.Field("version", treeVersion), logx.Field("error", err.Error()))
+			panic("rollback failed")
+		} else {
+			logx.Infow("rollback", logx.Field("version", treeVersion), logx.Field("accountTreeRoot", hex.EncodeToString(w.accountTree.Root())))
+		}
+	} else if w.accountTree.LatestVersion() < treeVersion {
+		panic("account tree version is less than current height")
+	} else {
+		logx.Infow("normal starting", logx.Field("height", height))
+	}
+	if checkpoint != nil && hex.EncodeToString(w.accountTree.Root()) != checkpoint.TreeRoot {
+		panic(fmt.Sprintf("account tree root %x doesn't match checkpoint root %s", w.accountTree.Root(), checkpoint.TreeRoot))
+	}
+}
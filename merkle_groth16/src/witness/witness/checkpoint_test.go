@@ -0,0 +1,143 @@
+package witness
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+
+	bsmt "github.com/bnb-chain/zkbnb-smt"
+)
+
+// checkpointTestModel keeps the checkpoints in memory, the other methods are not used.
+type checkpointTestModel struct {
+	WitnessModel
+	checkpoints []Checkpoint
+}
+
+func (m *checkpointTestModel) GetLatestCheckpoint() (*Checkpoint, error) {
+	if len(m.checkpoints) == 0 {
+		return nil, utils.DbErrNotFound
+	}
+	return &m.checkpoints[len(m.checkpoints)-1], nil
+}
+
+func (m *checkpointTestModel) CreateCheckpoint(checkpoint *Checkpoint) error {
+	m.checkpoints = append(m.checkpoints, *checkpoint)
+	return nil
+}
+
+func newCheckpointTestAccounts() []utils.AccountInfo {
+	return []utils.AccountInfo{
+		{AccountIndex: 0, AccountId: []byte{1}, TotalEquity: big.NewInt(5), TotalDebt: big.NewInt(0),
+			Assets: []utils.AccountAsset{{Index: 0, Balance: 5}}},
+		{AccountIndex: 1, AccountId: []byte{2}, TotalEquity: big.NewInt(0), TotalDebt: big.NewInt(3),
+			Assets: []utils.AccountAsset{{Index: 1, Balance: -3}}},
+	}
+}
+
+// newCheckpointTestWitness commits a tree version for each of the accounts and returns the
+// batch witness of height 0 with the root of version 1.
+func newCheckpointTestWitness(t *testing.T, model WitnessModel) (*Witness, *BatchWitness) {
+	accountTree, err := utils.NewAccountTree("memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := newCheckpointTestAccounts()
+	var batchWitness *BatchWitness
+	for i := 0; i < len(accounts); i++ {
+		err = accountTree.Set(uint64(i), bytes.Repeat([]byte{byte(i + 1)}, 32))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = accountTree.Commit(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			var buf bytes.Buffer
+			err = gob.NewEncoder(&buf).Encode(&utils.BatchCreateUserWitness{AfterAccountTreeRoot: accountTree.Root()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			batchWitness = &BatchWitness{Height: 0, WitnessData: base64.StdEncoding.EncodeToString(buf.Bytes())}
+		}
+	}
+	w := &Witness{
+		accountTree:  accountTree,
+		witnessModel: model,
+		ops:          accounts,
+		inputHash:    ComputeInputHash(accounts, nil),
+	}
+	return w, batchWitness
+}
+
+func TestComputeInputHash(t *testing.T) {
+	accounts := newCheckpointTestAccounts()
+	inputHash := ComputeInputHash(accounts, nil)
+	if inputHash != ComputeInputHash(newCheckpointTestAccounts(), nil) {
+		t.Fatal("the input hash is not deterministic")
+	}
+	accounts[1].Assets[0].Balance = -4
+	if inputHash == ComputeInputHash(accounts, nil) {
+		t.Fatal("the input hash doesn't depend on the balances")
+	}
+	cexAssets := []utils.CexAssetInfo{{Index: 0, Symbol: "btc", BasePrice: 1}}
+	if inputHash == ComputeInputHash(newCheckpointTestAccounts(), cexAssets) {
+		t.Fatal("the input hash doesn't depend on the prices")
+	}
+}
+
+func TestCheckConsistencyRollback(t *testing.T) {
+	model := &checkpointTestModel{}
+	w, batchWitness := newCheckpointTestWitness(t, model)
+
+	// the tree is at version 2 but the db stopped at height 0, the checkpoint is created
+	// from the batch witness and the tree is rolled back to it
+	w.CheckConsistency(0, batchWitness)
+	if w.accountTree.LatestVersion() != bsmt.Version(1) {
+		t.Fatalf("tree version is %d, expected 1", w.accountTree.LatestVersion())
+	}
+	if len(model.checkpoints) != 1 || model.checkpoints[0].TreeRoot != hex.EncodeToString(w.accountTree.Root()) {
+		t.Fatal("the checkpoint is not created from the batch witness")
+	}
+	// a restart with the same state passes
+	w.CheckConsistency(0, batchWitness)
+}
+
+func TestCheckConsistencyRefuse(t *testing.T) {
+	assertPanics := func(name string, f func()) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal(name, " doesn't panic")
+			}
+		}()
+		f()
+	}
+
+	model := &checkpointTestModel{}
+	w, batchWitness := newCheckpointTestWitness(t, model)
+	w.CheckConsistency(0, batchWitness)
+
+	w.inputHash = ComputeInputHash(w.ops[:1], nil)
+	assertPanics("another input", func() { w.CheckConsistency(0, batchWitness) })
+
+	model = &checkpointTestModel{}
+	w, batchWitness = newCheckpointTestWitness(t, model)
+	w.CheckConsistency(0, batchWitness)
+	assertPanics("a db behind the checkpoint", func() { w.CheckConsistency(-1, nil) })
+
+	model = &checkpointTestModel{}
+	w, batchWitness = newCheckpointTestWitness(t, model)
+	w.CheckConsistency(0, batchWitness)
+	model.checkpoints[0].TreeRoot = hex.EncodeToString(make([]byte, 32))
+	assertPanics("another tree root", func() { w.CheckConsistency(0, batchWitness) })
+
+	model = &checkpointTestModel{}
+	w, batchWitness = newCheckpointTestWitness(t, model)
+	assertPanics("a tree behind the db", func() { w.CheckConsistency(2, batchWitness) })
+}
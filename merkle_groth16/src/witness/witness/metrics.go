@@ -0,0 +1,34 @@
+package witness
+
+import (
+	"context"
+	"time"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// ReportQueueDepth sets utils.WitnessQueueGauge from the witness table every interval
+// until ctx is done.
+func ReportQueueDepth(ctx context.Context, witnessModel WitnessModel, interval time.Duration) {
+	statuses := []string{"published", "received", "finished", "failed"}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		counts, err := witnessModel.GetRowCounts()
+		if err != nil {
+			logx.Errorw("get witness counts failed", logx.Field("error", err.Error()))
+		} else {
+			// counts[0] is the total
+			for i, status := range statuses {
+				utils.WitnessQueueGauge.WithLabelValues(status).Set(float64(counts[i+1]))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package witness
+
+import (
+	"context"
+	"encoding/hex"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/witness/config"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// RunService parses the user data and the asset prices of witnessConfig, opens its account
+// tree and generates the remaining batch witnesses until done or ctx is cancelled.
+func RunService(ctx context.Context, witnessConfig *config.Config) {
+	utils.StartMetricsServer(witnessConfig.MetricsAddr)
+	accounts, cexAssetsInfo, err := utils.ParseUserDataSet(witnessConfig.UserDataFile)
+	if err != nil {
+		panic(err.Error())
+	}
+	accounts, err = utils.ApplyAssetPrices(accounts, cexAssetsInfo, witnessConfig.AssetPriceFile)
+	if err != nil {
+		panic(err.Error())
+	}
+	logx.Infow("account counts", logx.Field("accounts", len(accounts)))
+	accounts = utils.ArrangeAccountsByUserAssetCounts(accounts)
+	accountTree, err := utils.NewAccountTree(witnessConfig.TreeDB.Driver, witnessConfig.TreeDB.Option.Addr)
+	if err != nil {
+		panic(err.Error())
+	}
+	logx.Infow("account tree init", logx.Field("version", accountTree.LatestVersion()),
+		logx.Field("accountTreeRoot", hex.EncodeToString(accountTree.Root())))
+	witnessService := NewWitness(accountTree, uint32(len(accounts)), accounts, cexAssetsInfo, witnessConfig)
+	witnessService.Run(ctx)
+	logx.Info("witness service run finished")
+}
@@ -2,12 +2,11 @@ package witness
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/gob"
-	"fmt"
-	"log"
+	"encoding/hex"
 	"math/big"
-	"os"
 	"runtime"
 	"sync/atomic"
 	"time"
@@ -17,9 +16,8 @@ import (
 
 	bsmt "github.com/bnb-chain/zkbnb-smt"
 	"github.com/consensys/gnark-crypto/ecc/bn254/fr/poseidon"
-	"gorm.io/driver/mysql"
+	"github.com/zeromicro/go-zero/core/logx"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 type Witness struct {
@@ -29,29 +27,24 @@ type Witness struct {
 	ops                []utils.AccountInfo
 	cexAssets          []utils.CexAssetInfo
 	db                 *gorm.DB
-	ch                 chan BatchWitness
+	ch                 chan batchWitnessWithCheckpoint
 	quit               chan int
 	accountHashChan    [utils.BatchCreateUserOpsCounts]chan []byte
 	currentBatchNumber int64
+	inputHash          string
+	metricsEnabled     bool
+}
+
+type batchWitnessWithCheckpoint struct {
+	witness    BatchWitness
+	checkpoint Checkpoint
 }
 
 // NewWitness 创建 Witness 结构体
 func NewWitness(accountTree bsmt.SparseMerkleTree, totalOpsNumber uint32,
 	ops []utils.AccountInfo, cexAssets []utils.CexAssetInfo,
 	config *config.Config) *Witness {
-	newLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
-		logger.Config{
-			SlowThreshold:             60 * time.Second, // Slow SQL threshold
-			LogLevel:                  logger.Silent,    // Log level
-			IgnoreRecordNotFoundError: true,             // Ignore ErrRecordNotFound error for logger
-			Colorful:                  false,            // Disable color
-		},
-	)
-	db, err := gorm.Open(mysql.Open(config.MysqlDataSource), &gorm.Config{
-		Logger: newLogger,
-	})
-	fmt.Println("db=", db)
+	db, err := utils.OpenDB(config.DbDriver, config.MysqlDataSource, config.Log)
 	if err != nil {
 		panic(err.Error())
 	}
@@ -61,15 +54,23 @@ func NewWitness(accountTree bsmt.SparseMerkleTree, totalOpsNumber uint32,
 		witnessModel:       NewWitnessModel(db, config.DbSuffix),
 		ops:                ops,
 		cexAssets:          cexAssets,
-		ch:                 make(chan BatchWitness, 100),
+		ch:                 make(chan batchWitnessWithCheckpoint, 100),
 		quit:               make(chan int, 1),
 		currentBatchNumber: 0,
+		inputHash:          ComputeInputHash(ops, cexAssets),
+		metricsEnabled:     config.MetricsAddr != "",
 	}
 }
 
-func (w *Witness) Run() {
+// Run generates the remaining batch witnesses. When ctx is cancelled it stops after the
+// batch in progress, whose tree version and witness are committed together as usual.
+func (w *Witness) Run(ctx context.Context) {
 	// create table first
 	w.witnessModel.CreateBatchWitnessTable()
+	w.witnessModel.CreateCheckpointTable()
+	if w.metricsEnabled {
+		go ReportQueueDepth(ctx, w.witnessModel, 10*time.Second)
+	}
 	latestWitness, err := w.witnessModel.GetLatestBatchWitness()
 	var height int64
 	beforeTotalCexAssets := utils.CexAssetsTotal{
@@ -89,42 +90,43 @@ func (w *Witness) Run() {
 		w.cexAssets, beforeTotalCexAssets = w.GetCexAssets(latestWitness)
 	}
 
+	w.CheckConsistency(height, latestWitness)
+
 	batchNumber := (w.totalOpsNumber + utils.BatchCreateUserOpsCounts - 1) / utils.BatchCreateUserOpsCounts
 	if height == int64(batchNumber)-1 {
-		fmt.Println("already generate all accounts witness")
+		// the checkpoint of a db written before the completion marker isn't completed yet
+		if height >= 0 {
+			err = w.witnessModel.CompleteCheckpoint(height)
+			if err != nil {
+				panic(err.Error())
+			}
+		}
+		logx.Infow("already generate all accounts witness", logx.Field("height", height))
 		return
 	}
 	w.currentBatchNumber = height
-	fmt.Println("latest height is ", height)
+	logx.Infow("latest height", logx.Field("height", height))
 
-	// tree version
-	if w.accountTree.LatestVersion() > bsmt.Version(height+1) {
-		rollbackVersion := bsmt.Version(height + 1)
-		err = w.accountTree.Rollback(rollbackVersion)
-		if err != nil {
-			fmt.Println("rollback failed ", rollbackVersion, err.Error())
-			panic("rollback failed")
-		} else {
-			fmt.Printf("rollback to %x\n", w.accountTree.Root())
-		}
-	} else if w.accountTree.LatestVersion() < bsmt.Version(height+1) {
-		panic("account tree version is less than current height")
-	} else {
-		fmt.Println("normal starting...")
+	// the last batch is proven by the smallest circuit which holds its accounts, so it
+	// is padded up to that batch size only
+	lastBatchCounts := uint32(utils.GetBatchCreateUserOpsCounts(int(w.totalOpsNumber - (batchNumber-1)*utils.BatchCreateUserOpsCounts)))
+	paddedOpsNumber := (batchNumber-1)*utils.BatchCreateUserOpsCounts + lastBatchCounts
+	paddingAccountCounts := paddedOpsNumber - w.totalOpsNumber
+	// padding accounts take the asset slots of the last batch
+	paddingUserAssetCounts := utils.SparseUserAssetCounts
+	if w.totalOpsNumber > 0 {
+		paddingUserAssetCounts = len(w.ops[w.totalOpsNumber-1].Assets)
 	}
-
-	paddingAccountCounts := batchNumber*utils.BatchCreateUserOpsCounts - w.totalOpsNumber
 	for i := uint32(0); i < paddingAccountCounts; i++ {
 		emptyAccount := utils.AccountInfo{
 			AccountIndex: i + w.totalOpsNumber,
 			TotalEquity:  new(big.Int).SetInt64(0),
 			TotalDebt:    new(big.Int).SetInt64(0),
-			Assets:       make([]utils.AccountAsset, 0),
+			Assets:       utils.PaddingAccountAssets(nil, paddingUserAssetCounts),
 		}
 		w.ops = append(w.ops, emptyAccount)
 	}
 
-	poseidonHasher := poseidon.NewPoseidon()
 	go w.WriteBatchWitnessToDB()
 	for i := 0; i < utils.BatchCreateUserOpsCounts; i++ {
 		w.accountHashChan[i] = make(chan []byte, 1)
@@ -146,6 +148,9 @@ func (w *Witness) Run() {
 				if highAccountIndex > (j+1)*utils.BatchCreateUserOpsCounts {
 					highAccountIndex = (j + 1) * utils.BatchCreateUserOpsCounts
 				}
+				if highAccountIndex > int64(paddedOpsNumber) {
+					highAccountIndex = int64(paddedOpsNumber)
+				}
 				currentAccountIndex := j * utils.BatchCreateUserOpsCounts
 				w.ComputeAccountHash(uint32(lowAccountIndex), uint32(highAccountIndex), uint32(currentAccountIndex))
 			}
@@ -153,6 +158,14 @@ func (w *Witness) Run() {
 	}
 
 	for i := height + 1; i < int64(batchNumber); i++ {
+		if ctx.Err() != nil {
+			logx.Infow("witness service is cancelled", logx.Field("height", i))
+			break
+		}
+		batchCounts := int64(utils.BatchCreateUserOpsCounts)
+		if i == int64(batchNumber)-1 {
+			batchCounts = int64(lastBatchCounts)
+		}
 		totalCexAssets := utils.CexAssetsTotal{
 			BeforeCEXTotalEquity: beforeTotalCexAssets.AfterCEXTotalEquity,
 			AfterCEXTotalEquity:  0,
@@ -162,21 +175,17 @@ func (w *Witness) Run() {
 		batchCreateUserWit := &utils.BatchCreateUserWitness{
 			BeforeAccountTreeRoot: w.accountTree.Root(),
 			BeforeCexAssets:       make([]utils.CexAssetInfo, utils.AssetCounts),
-			CreateUserOps:         make([]utils.CreateUserOperation, utils.BatchCreateUserOpsCounts),
+			CreateUserOps:         make([]utils.CreateUserOperation, batchCounts),
 			TotalCexAssets:        totalCexAssets,
 		}
 		copy(batchCreateUserWit.BeforeCexAssets[:], w.cexAssets[:])
-		for j := 0; j < len(w.cexAssets); j++ {
-			commitment := utils.ConvertAssetInfoToBytes(w.cexAssets[j])
-			poseidonHasher.Write(commitment)
-		}
-		batchCreateUserWit.BeforeCEXAssetsCommitment = poseidonHasher.Sum(nil)
-		poseidonHasher.Reset()
+		batchCreateUserWit.BeforeCEXAssetsCommitment = utils.ComputeCexAssetsCommitment(w.cexAssets,
+			totalCexAssets.BeforeCEXTotalEquity, totalCexAssets.BeforeCEXTotalDebt)
 
 		batchCreateUserWit.TotalCexAssets.AfterCEXTotalEquity = batchCreateUserWit.TotalCexAssets.BeforeCEXTotalEquity
 		batchCreateUserWit.TotalCexAssets.AfterCEXTotalDebt = batchCreateUserWit.TotalCexAssets.BeforeCEXTotalDebt
 
-		for j := i * utils.BatchCreateUserOpsCounts; j < (i+1)*utils.BatchCreateUserOpsCounts; j++ {
+		for j := i * utils.BatchCreateUserOpsCounts; j < i*utils.BatchCreateUserOpsCounts+batchCounts; j++ {
 			w.ExecuteBatchCreateUser(uint32(j), uint32(i), batchCreateUserWit)
 			index := uint32(j) - uint32(i)*utils.BatchCreateUserOpsCounts
 			batchCreateUserWit.TotalCexAssets.AfterCEXTotalEquity = utils.SafeAdd(
@@ -184,12 +193,8 @@ func (w *Witness) Run() {
 			batchCreateUserWit.TotalCexAssets.AfterCEXTotalDebt = utils.SafeAdd(
 				batchCreateUserWit.TotalCexAssets.AfterCEXTotalDebt, batchCreateUserWit.CreateUserOps[index].TotalDebt)
 		}
-		for j := 0; j < len(w.cexAssets); j++ {
-			commitment := utils.ConvertAssetInfoToBytes(w.cexAssets[j])
-			poseidonHasher.Write(commitment)
-		}
-		batchCreateUserWit.AfterCEXAssetsCommitment = poseidonHasher.Sum(nil)
-		poseidonHasher.Reset()
+		batchCreateUserWit.AfterCEXAssetsCommitment = utils.ComputeCexAssetsCommitment(w.cexAssets,
+			batchCreateUserWit.TotalCexAssets.AfterCEXTotalEquity, batchCreateUserWit.TotalCexAssets.AfterCEXTotalDebt)
 		batchCreateUserWit.AfterAccountTreeRoot = w.accountTree.Root()
 
 		// compute batch commitment
@@ -211,17 +216,30 @@ func (w *Witness) Run() {
 			Status:      StatusPublished,
 		}
 		accPrunedVersion := bsmt.Version(atomic.LoadInt64(&w.currentBatchNumber) + 1)
+		commitStartTime := time.Now()
 		ver, err := w.accountTree.Commit(&accPrunedVersion)
 		if err != nil {
-			fmt.Println("ver is ", ver)
+			logx.Errorw("account tree commit failed", logx.Field("height", i), logx.Field("version", ver), logx.Field("error", err.Error()))
 			panic(err.Error())
 		}
-		w.ch <- witness
+		utils.WitnessTreeCommitHistogram.Observe(time.Since(commitStartTime).Seconds())
+		w.ch <- batchWitnessWithCheckpoint{
+			witness: witness,
+			checkpoint: Checkpoint{
+				Height:      witness.Height,
+				TreeVersion: int64(ver),
+				TreeRoot:    hex.EncodeToString(w.accountTree.Root()),
+				InputHash:   w.inputHash,
+				Completed:   i == int64(batchNumber)-1,
+			},
+		}
+		// the cex totals are committed, so the next batch has to continue from them
+		beforeTotalCexAssets = batchCreateUserWit.TotalCexAssets
 	}
 	close(w.ch)
 	<-w.quit
-	fmt.Println("cex assets info is ", w.cexAssets)
-	fmt.Printf("witness run finished, the account tree root is %x\n", w.accountTree.Root())
+	logx.Infow("witness run finished", logx.Field("cexAssets", w.cexAssets),
+		logx.Field("accountTreeRoot", hex.EncodeToString(w.accountTree.Root())))
 }
 
 func (w *Witness) GetCexAssets(wit *BatchWitness) ([]utils.CexAssetInfo, utils.CexAssetsTotal) {
@@ -231,21 +249,22 @@ func (w *Witness) GetCexAssets(wit *BatchWitness) ([]utils.CexAssetInfo, utils.C
 	}
 	cexAssetsInfo := utils.RecoverAfterCexAssets(witness)
 	totalCexAssets := utils.RecoverAfterTotalCexAssets(witness)
-	fmt.Println("recover cex assets successfully")
+	logx.Infow("recover cex assets successfully", logx.Field("height", wit.Height))
 	return cexAssetsInfo, totalCexAssets
 }
 
 func (w *Witness) WriteBatchWitnessToDB() {
 	datas := make([]BatchWitness, 1)
-	for witness := range w.ch {
-		datas[0] = witness
-		err := w.witnessModel.CreateBatchWitness(datas)
+	for item := range w.ch {
+		datas[0] = item.witness
+		err := w.witnessModel.CreateBatchWitnessWithCheckpoint(datas, &item.checkpoint)
 		if err != nil {
 			panic("create batch witness failed " + err.Error())
 		}
-		atomic.StoreInt64(&w.currentBatchNumber, witness.Height)
-		if witness.Height%100 == 0 {
-			fmt.Println("save batch ", witness.Height, " to db")
+		atomic.StoreInt64(&w.currentBatchNumber, item.witness.Height)
+		utils.WitnessBatchesCounter.Inc()
+		if item.witness.Height%100 == 0 {
+			logx.Infow("save batch to db", logx.Field("height", item.witness.Height))
 		}
 	}
 	w.quit <- 0
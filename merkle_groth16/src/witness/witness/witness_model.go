@@ -11,10 +11,12 @@ const (
 	StatusPublished = iota
 	StatusReceived
 	StatusFinished
+	StatusFailed
 )
 
 const (
-	TableNamePrefix = `witness`
+	TableNamePrefix           = `witness`
+	CheckpointTableNamePrefix = `witness_checkpoint`
 )
 
 type (
@@ -28,25 +30,62 @@ type (
 		GetLatestBatchWitnessByStatus(status int64) (witness *BatchWitness, err error)
 		CreateBatchWitness(witness []BatchWitness) error
 		GetRowCounts() (count []int64, err error)
+		CreateCheckpointTable() error
+		DropCheckpointTable() error
+		GetLatestCheckpoint() (checkpoint *Checkpoint, err error)
+		CreateCheckpoint(checkpoint *Checkpoint) error
+		CreateBatchWitnessWithCheckpoint(witness []BatchWitness, checkpoint *Checkpoint) error
+		CompleteCheckpoint(height int64) error
+		IsBatchWitnessCompleted() (bool, error)
+		GetClaimableBatchWitness(now int64) (witness *BatchWitness, err error)
+		GetExpiredBatchWitness(now int64) (witness *BatchWitness, err error)
+		ClaimBatchWitness(witness *BatchWitness, owner string, leaseExpiry int64) error
+		RenewBatchWitnessLease(height int64, owner string, leaseExpiry int64) error
+		ReleaseBatchWitness(witness *BatchWitness, owner string) error
+		FailBatchWitness(witness *BatchWitness, owner string, errorMessage string, maxAttempts int64) error
+		GetFailedBatchWitnesses() (witnesses []BatchWitness, err error)
 	}
 
 	defaultWitnessModel struct {
-		table string
-		DB    *gorm.DB
+		table           string
+		checkpointTable string
+		DB              *gorm.DB
 	}
 
 	BatchWitness struct {
 		gorm.Model
-		Height      int64 `gorm:"index:idx_height,unique"`
+		Height      int64 `gorm:"index:,unique"`
 		WitnessData string
 		Status      int64 `gorm:"index"`
+		// a received witness is leased by the prover Owner until LeaseExpiry (unix seconds),
+		// which is renewed by its heartbeats, and can be claimed by any prover afterwards
+		Owner       string
+		LeaseExpiry int64 `gorm:"index"`
+		// the failed proving attempts and the error of the last one, the witness is
+		// StatusFailed once Attempts reaches the max attempts of the prover
+		Attempts     int64
+		ErrorMessage string
+	}
+
+	// Checkpoint is written in the same transaction as the batch witness of Height, so it
+	// records the account tree version and root which the witness service has to resume
+	// from, and the hash of the input data the batches are built from. The checkpoint of
+	// the last batch is Completed, which tells the provers no more witnesses will come.
+	Checkpoint struct {
+		gorm.Model
+		Height      int64 `gorm:"index:,unique"`
+		TreeVersion int64
+		TreeRoot    string
+		InputHash   string
+		Completed   bool
 	}
 )
 
 func NewWitnessModel(db *gorm.DB, suffix string) WitnessModel {
 	return &defaultWitnessModel{
-		table: TableNamePrefix + suffix,
-		DB:    db,
+		table:           TableNamePrefix + suffix,
+		checkpointTable: CheckpointTableNamePrefix + suffix,
+		DB:              db,
 	}
 }
 
@@ -75,7 +114,7 @@ func (m *defaultWitnessModel) GetLatestBatchWitnessHeight() (batchNumber int64,
 
 func (m *defaultWitnessModel) GetLatestBatchWitness() (witness *BatchWitness, err error) {
 	var height int64
-	dbTx := m.DB.Table(m.table).Debug().Select("height").Order("height desc").Limit(1).Find(&height)
+	dbTx := m.DB.Table(m.table).Select("height").Order("height desc").Limit(1).Find(&height)
 	if dbTx.Error != nil {
 		return nil, dbTx.Error
 	} else if dbTx.RowsAffected == 0 {
@@ -153,5 +192,201 @@ func (m *defaultWitnessModel) GetRowCounts() (counts []int64, err error) {
 		return nil, dbTx.Error
 	}
 	counts = append(counts, finishedCount)
+
+	var failedCount int64
+	dbTx = m.DB.Table(m.table).Where("status = ?", StatusFailed).Count(&failedCount)
+	if dbTx.Error != nil {
+		return nil, dbTx.Error
+	}
+	counts = append(counts, failedCount)
 	return counts, nil
 }
+
+func (m *defaultWitnessModel) CreateCheckpointTable() error {
+	return m.DB.Table(m.checkpointTable).AutoMigrate(Checkpoint{})
+}
+
+func (m *defaultWitnessModel) DropCheckpointTable() error {
+	return m.DB.Migrator().DropTable(m.checkpointTable)
+}
+
+func (m *defaultWitnessModel) GetLatestCheckpoint() (checkpoint *Checkpoint, err error) {
+	dbTx := m.DB.Table(m.checkpointTable).Order("height desc").Limit(1).Find(&checkpoint)
+	if dbTx.Error != nil {
+		return nil, utils.DbErrSqlOperation
+	} else if dbTx.RowsAffected == 0 {
+		return nil, utils.DbErrNotFound
+	}
+	return checkpoint, nil
+}
+
+func (m *defaultWitnessModel) CreateCheckpoint(checkpoint *Checkpoint) error {
+	dbTx := m.DB.Table(m.checkpointTable).Create(checkpoint)
+	if dbTx.Error != nil {
+		return utils.DbErrSqlOperation
+	}
+	return nil
+}
+
+func (m *defaultWitnessModel) CreateBatchWitnessWithCheckpoint(witness []BatchWitness, checkpoint *Checkpoint) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		dbTx := tx.Table(m.table).Create(witness)
+		if dbTx.Error != nil {
+			return dbTx.Error
+		}
+		return tx.Table(m.checkpointTable).Create(checkpoint).Error
+	})
+	if err != nil {
+		return utils.DbErrSqlOperation
+	}
+	return nil
+}
+
+// CompleteCheckpoint marks the checkpoint of height, the last batch, completed.
+func (m *defaultWitnessModel) CompleteCheckpoint(height int64) error {
+	dbTx := m.DB.Table(m.checkpointTable).Where("height = ?", height).Updates(map[string]interface{}{
+		"updated_at": time.Now(),
+		"completed":  true,
+	})
+	if dbTx.Error != nil {
+		return utils.DbErrSqlOperation
+	} else if dbTx.RowsAffected == 0 {
+		return utils.DbErrNotFound
+	}
+	return nil
+}
+
+// IsBatchWitnessCompleted reports whether the witness service wrote the witnesses of all
+// batches, which is false before the first one is written.
+func (m *defaultWitnessModel) IsBatchWitnessCompleted() (bool, error) {
+	if !m.DB.Migrator().HasTable(m.checkpointTable) {
+		return false, nil
+	}
+	checkpoint, err := m.GetLatestCheckpoint()
+	if err == utils.DbErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return checkpoint.Completed, nil
+}
+
+// GetClaimableBatchWitness returns a published witness or a received one whose lease
+// expired before now.
+func (m *defaultWitnessModel) GetClaimableBatchWitness(now int64) (witness *BatchWitness, err error) {
+	dbTx := m.DB.Table(m.table).Where("status = ? OR (status = ? AND lease_expiry < ?)", StatusPublished, StatusReceived, now).
+		Order("height").Limit(1).Find(&witness)
+	if dbTx.Error != nil {
+		return nil, utils.DbErrSqlOperation
+	} else if dbTx.RowsAffected == 0 {
+		return nil, utils.DbErrNotFound
+	}
+	return witness, nil
+}
+
+// GetExpiredBatchWitness returns a received witness whose lease expired before now.
+func (m *defaultWitnessModel) GetExpiredBatchWitness(now int64) (witness *BatchWitness, err error) {
+	dbTx := m.DB.Table(m.table).Where("status = ? AND lease_expiry < ?", StatusReceived, now).
+		Order("height").Limit(1).Find(&witness)
+	if dbTx.Error != nil {
+		return nil, utils.DbErrSqlOperation
+	} else if dbTx.RowsAffected == 0 {
+		return nil, utils.DbErrNotFound
+	}
+	return witness, nil
+}
+
+// ClaimBatchWitness marks witness received and leased by owner until leaseExpiry. The
+// update is conditional on the status and the lease witness was read with, so of the
+// provers claiming the same witness only one succeeds, the others get
+// utils.BatchWitnessClaimed.
+func (m *defaultWitnessModel) ClaimBatchWitness(witness *BatchWitness, owner string, leaseExpiry int64) error {
+	dbTx := m.DB.Table(m.table).Where("height = ? AND status = ? AND owner = ? AND lease_expiry = ?",
+		witness.Height, witness.Status, witness.Owner, witness.LeaseExpiry).
+		Updates(map[string]interface{}{
+			"updated_at":   time.Now(),
+			"status":       StatusReceived,
+			"owner":        owner,
+			"lease_expiry": leaseExpiry,
+		})
+	if dbTx.Error != nil {
+		return utils.DbErrSqlOperation
+	} else if dbTx.RowsAffected == 0 {
+		return utils.BatchWitnessClaimed
+	}
+	witness.Status, witness.Owner, witness.LeaseExpiry = StatusReceived, owner, leaseExpiry
+	return nil
+}
+
+// RenewBatchWitnessLease extends the lease of owner on the witness of height, it fails with
+// utils.BatchWitnessLeaseLost if the witness is leased by another prover or isn't received
+// any more. The loaded BatchWitness is left untouched, the heartbeats of the prover renew
+// the lease while the witness is updated by the proving worker.
+func (m *defaultWitnessModel) RenewBatchWitnessLease(height int64, owner string, leaseExpiry int64) error {
+	dbTx := m.DB.Table(m.table).Where("height = ? AND status = ? AND owner = ?", height, StatusReceived, owner).
+		Updates(map[string]interface{}{
+			"updated_at":   time.Now(),
+			"lease_expiry": leaseExpiry,
+		})
+	if dbTx.Error != nil {
+		return utils.DbErrSqlOperation
+	} else if dbTx.RowsAffected == 0 {
+		return utils.BatchWitnessLeaseLost
+	}
+	return nil
+}
+
+// ReleaseBatchWitness publishes witness again if it is still leased by owner.
+func (m *defaultWitnessModel) ReleaseBatchWitness(witness *BatchWitness, owner string) error {
+	dbTx := m.DB.Table(m.table).Where("height = ? AND status = ? AND owner = ?", witness.Height, StatusReceived, owner).
+		Updates(map[string]interface{}{
+			"updated_at":   time.Now(),
+			"status":       StatusPublished,
+			"owner":        "",
+			"lease_expiry": 0,
+		})
+	if dbTx.Error != nil {
+		return utils.DbErrSqlOperation
+	} else if dbTx.RowsAffected == 0 {
+		return utils.BatchWitnessLeaseLost
+	}
+	return nil
+}
+
+// FailBatchWitness records a failed proving attempt of owner with errorMessage. The witness
+// is published again for another attempt, or is StatusFailed once it failed maxAttempts
+// times. It fails with utils.BatchWitnessLeaseLost if owner doesn't lease witness any more.
+func (m *defaultWitnessModel) FailBatchWitness(witness *BatchWitness, owner string, errorMessage string, maxAttempts int64) error {
+	status := int64(StatusPublished)
+	if witness.Attempts+1 >= maxAttempts {
+		status = StatusFailed
+	}
+	dbTx := m.DB.Table(m.table).Where("height = ? AND status = ? AND owner = ?", witness.Height, StatusReceived, owner).
+		Updates(map[string]interface{}{
+			"updated_at":    time.Now(),
+			"status":        status,
+			"owner":         "",
+			"lease_expiry":  0,
+			"attempts":      gorm.Expr("attempts + 1"),
+			"error_message": errorMessage,
+		})
+	if dbTx.Error != nil {
+		return utils.DbErrSqlOperation
+	} else if dbTx.RowsAffected == 0 {
+		return utils.BatchWitnessLeaseLost
+	}
+	witness.Status, witness.Owner, witness.LeaseExpiry = status, "", 0
+	witness.Attempts, witness.ErrorMessage = witness.Attempts+1, errorMessage
+	return nil
+}
+
+// GetFailedBatchWitnesses returns the witnesses which failed all their proving attempts
+// ordered by height, without their witness data.
+func (m *defaultWitnessModel) GetFailedBatchWitnesses() (witnesses []BatchWitness, err error) {
+	dbTx := m.DB.Table(m.table).Select("id", "created_at", "updated_at", "height", "status", "attempts", "error_message").
+		Where("status = ?", StatusFailed).Order("height").Find(&witnesses)
+	if dbTx.Error != nil {
+		return nil, utils.DbErrSqlOperation
+	}
+	return witnesses, nil
+}
@@ -0,0 +1,67 @@
+package witness
+
+import (
+	"path/filepath"
+	"testing"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+func TestWitnessModelSqlite(t *testing.T) {
+	db, err := utils.OpenDB(utils.DbDriverSqlite, filepath.Join(t.TempDir(), "por.db"), utils.LogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the index names of the tables of two suffixes don't collide
+	model := NewWitnessModel(db, "0")
+	for _, m := range []WitnessModel{model, NewWitnessModel(db, "1")} {
+		if err = m.CreateBatchWitnessTable(); err != nil {
+			t.Fatal(err)
+		}
+		if err = m.CreateCheckpointTable(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	witnesses := []BatchWitness{{Height: 0, WitnessData: "w0"}, {Height: 1, WitnessData: "w1"}}
+	err = model.CreateBatchWitnessWithCheckpoint(witnesses, &Checkpoint{Height: 1, TreeRoot: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = model.CompleteCheckpoint(1); err != nil {
+		t.Fatal(err)
+	}
+	completed, err := model.IsBatchWitnessCompleted()
+	if err != nil || !completed {
+		t.Fatalf("completed %v, %v", completed, err)
+	}
+
+	witness, err := model.GetClaimableBatchWitness(100)
+	if err != nil || witness.Height != 0 {
+		t.Fatalf("claimable witness %+v, %v", witness, err)
+	}
+	stale := *witness
+	if err = model.ClaimBatchWitness(witness, "a", 200); err != nil {
+		t.Fatal(err)
+	}
+	if err = model.ClaimBatchWitness(&stale, "b", 200); err != utils.BatchWitnessClaimed {
+		t.Fatalf("a claimed witness is claimed again: %v", err)
+	}
+	if err = model.FailBatchWitness(witness, "a", "out of memory", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err = model.ClaimBatchWitness(witness, "b", 300); err != nil {
+		t.Fatal(err)
+	}
+	if err = model.FailBatchWitness(witness, "b", "out of memory", 2); err != nil {
+		t.Fatal(err)
+	}
+	failed, err := model.GetFailedBatchWitnesses()
+	if err != nil || len(failed) != 1 || failed[0].Attempts != 2 || failed[0].ErrorMessage != "out of memory" {
+		t.Fatalf("failed witnesses %+v, %v", failed, err)
+	}
+	counts, err := model.GetRowCounts()
+	if err != nil || counts[0] != 2 || counts[1] != 1 || counts[4] != 1 {
+		t.Fatalf("row counts %v, %v", counts, err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	dbtoolConfig "merkleverifytool/merkle_groth16/src/dbtool/config"
+	exportConfig "merkleverifytool/merkle_groth16/src/export/config"
+	proverConfig "merkleverifytool/merkle_groth16/src/prover/config"
+	userInclusionConfig "merkleverifytool/merkle_groth16/src/userinclusion/config"
+	userproofConfig "merkleverifytool/merkle_groth16/src/userproof/config"
+	verifierConfig "merkleverifytool/merkle_groth16/src/verifier/config"
+	witnessConfig "merkleverifytool/merkle_groth16/src/witness/config"
+)
+
+type serviceConfig struct {
+	defaultPath string
+	new         func() interface{}
+}
+
+// serviceConfigs are the configs "config check" validates by service name.
+var serviceConfigs = map[string]serviceConfig{
+	"witness":       {witnessConfigPath, func() interface{} { return &witnessConfig.Config{} }},
+	"prover":        {proverConfigPath, func() interface{} { return &proverConfig.Config{} }},
+	"userproof":     {userproofConfigPath, func() interface{} { return &userproofConfig.Config{} }},
+	"verifier":      {verifierConfigPath, func() interface{} { return &verifierConfig.Config{} }},
+	"verifier-user": {verifierUserConfigPath, func() interface{} { return &verifierConfig.UserConfig{} }},
+	"dbtool":        {dbtoolConfigPath, func() interface{} { return &dbtoolConfig.Config{} }},
+	"export":        {exportConfigPath, func() interface{} { return &exportConfig.Config{} }},
+	"userinclusion": {userInclusionConfigPath, func() interface{} { return &userInclusionConfig.Config{} }},
+}
+
+func serviceNames() []string {
+	var names []string
+	for name := range serviceConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "inspect the configs of the services",
+}
+
+var configCheckCmd = &cobra.Command{
+	Use:   "check SERVICE",
+	Short: "load and validate the config of a service: " + strings.Join(serviceNames(), ", "),
+	Long: `check loads the config of SERVICE from --config or its default path with the env var
+overrides applied and validates it, without connecting to any db.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		service, ok := serviceConfigs[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown service %s, one of %s", args[0], strings.Join(serviceNames(), ", "))
+		}
+		if err := loadConfig(service.defaultPath, service.new()); err != nil {
+			return err
+		}
+		fmt.Printf("%s config is valid\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configCheckCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"merkleverifytool/merkle_groth16/src/dbtool/config"
+	"merkleverifytool/merkle_groth16/src/dbtool/dbtool"
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "inspect and reset the mysql tables and the kvrocks tree db",
+}
+
+// dbCommand is a db subcommand running fn with the dbtool config.
+func dbCommand(use string, short string, fn func(dbtoolConfig *config.Config)) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbtoolConfig := &config.Config{}
+			if err := loadConfig(dbtoolConfigPath, dbtoolConfig); err != nil {
+				return err
+			}
+			s, err := dataSource(dbtoolConfig.DbDriver, dbtoolConfig.MysqlDataSource)
+			if err != nil {
+				return err
+			}
+			dbtoolConfig.MysqlDataSource = s
+			utils.SetupLogger("dbtool", dbtoolConfig.Log)
+			fn(dbtoolConfig)
+			return nil
+		},
+	}
+}
+
+var cexAssetsVerifierConfig string
+
+func init() {
+	cexAssetsCmd := dbCommand("cex-assets", "write the cex assets of the latest witness into the verifier config",
+		func(dbtoolConfig *config.Config) {
+			path := cexAssetsVerifierConfig
+			if path == "" {
+				path = defaultConfigPath(verifierConfigPath)
+			}
+			dbtool.QueryCexAssets(dbtoolConfig, path)
+		})
+	cexAssetsCmd.Flags().StringVar(&cexAssetsVerifierConfig, "verifier-config", "", "verifier config to update, the default verifier config if empty")
+	dbCmd.AddCommand(
+		dbCommand("delete-all", "drop the tables and flush the kvrocks data", func(dbtoolConfig *config.Config) {
+			dbtool.DeleteAll(dbtoolConfig)
+			dbtool.FlushKvrocks(dbtoolConfig)
+		}),
+		dbCommand("flush-kvrocks", "flush the kvrocks data only", dbtool.FlushKvrocks),
+		dbCommand("status", "log the batch witness counts by status", dbtool.CheckProverStatus),
+		dbCommand("failed-witness", "list the batch witnesses which failed all proving attempts", dbtool.ListFailedWitness),
+		cexAssetsCmd,
+	)
+	rootCmd.AddCommand(dbCmd)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+
+	"merkleverifytool/merkle_groth16/src/bundle"
+
+	"merkleverifytool/merkle_groth16/src/export/config"
+	"merkleverifytool/merkle_groth16/src/export/export"
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export the batch proofs into a signed bundle for external verifiers",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		exportConfig := &config.Config{}
+		if err := loadConfig(exportConfigPath, exportConfig); err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("format") {
+			exportConfig.Format, _ = cmd.Flags().GetString("format")
+		}
+		if cmd.Flags().Changed("output") {
+			exportConfig.OutputFile, _ = cmd.Flags().GetString("output")
+		}
+		if err := exportConfig.Validate(); err != nil {
+			return err
+		}
+		s, err := dataSource(exportConfig.DbDriver, exportConfig.MysqlDataSource)
+		if err != nil {
+			return err
+		}
+		exportConfig.MysqlDataSource = s
+		utils.SetupLogger("export", exportConfig.Log)
+		return export.Export(exportConfig)
+	},
+}
+
+var exportSigningKeyCmd = &cobra.Command{
+	Use:   "signing-key FILE",
+	Short: "generate an ed25519 signing key of the bundles into FILE and print its public key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		seed, publicKey, err := bundle.GenerateKey()
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(args[0], []byte(seed+"\n"), 0600)
+		if err != nil {
+			return err
+		}
+		fmt.Println(publicKey)
+		return nil
+	},
+}
+
+func init() {
+	exportCmd.Flags().String("format", "csv", "format of the proof table, csv or json, Format of the config if not set")
+	exportCmd.Flags().String("output", "", "tar.gz archive of the bundle, OutputFile of the config if not set")
+	exportCmd.AddCommand(exportSigningKeyCmd)
+	rootCmd.AddCommand(exportCmd)
+}
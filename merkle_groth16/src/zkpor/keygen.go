@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"merkleverifytool/merkle_groth16/src/keygen/keygen"
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "generate the r1cs, proving and verifying keys of a circuit into the working directory",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		summary, _ := cmd.Flags().GetBool("summary")
+		userInclusion, _ := cmd.Flags().GetBool("user-inclusion")
+		userAssetCounts, _ := cmd.Flags().GetInt("user-assets")
+		batchCounts, _ := cmd.Flags().GetInt("batch")
+		if err := keygen.ValidateCircuitFlags(summary, userInclusion); err != nil {
+			return err
+		}
+		if err := keygen.ValidateKeyParams(userAssetCounts, batchCounts); err != nil {
+			return err
+		}
+		keygen.GenerateKeys(summary, userInclusion, userAssetCounts, batchCounts)
+		return nil
+	},
+}
+
+func init() {
+	keygenCmd.Flags().Bool("summary", false, "generate keys of the cex summary circuit")
+	keygenCmd.Flags().Bool("user-inclusion", false, "generate keys of the user inclusion circuit")
+	keygenCmd.Flags().Int("user-assets", utils.AssetCounts, "asset slots per user, one of utils.UserAssetCountsTiers")
+	keygenCmd.Flags().Int("batch", utils.BatchCreateUserOpsCounts, "users per batch, one of utils.BatchCreateUserOpsCountsTiers")
+	rootCmd.AddCommand(keygenCmd)
+}
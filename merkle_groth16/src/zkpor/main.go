@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/zeromicro/go-zero/core/logx"
+
+	"merkleverifytool/merkle_groth16/src/conf"
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+// default configs of the subcommands without --config, relative to the merkle_groth16
+// directory, see defaultConfigPath
+const (
+	witnessConfigPath       = "src/witness/config/config.json"
+	proverConfigPath        = "src/prover/config/config.json"
+	userproofConfigPath     = "src/userproof/config/config.json"
+	verifierConfigPath      = "src/verifier/config/config.json"
+	verifierUserConfigPath  = "src/verifier/config/user_config.json"
+	dbtoolConfigPath        = "src/dbtool/config/config.json"
+	exportConfigPath        = "src/export/config/config.json"
+	userInclusionConfigPath = "src/userinclusion/config/config.json"
+)
+
+var configPath string
+var remotePasswdConfig string
+
+var rootCmd = &cobra.Command{
+	Use:   "zkpor",
+	Short: "zk proof of reserves pipeline",
+	Long: `zkpor runs the stages of the proof of reserves: keygen, witness, prove, userproof,
+export, verify, userinclusion and the db maintenance. Every stage reads its json, yaml or
+toml config from --config, defaulting to the path of the stage under merkle_groth16/src/
+next to the build directory of the executable, or under src/ of the working directory,
+every config field can be overridden by an env var such as ZKPOR_MYSQLDATASOURCE or
+ZKPOR_TREEDB_OPTION_ADDR, and the config is validated before the stage runs, see "zkpor config check".`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+}
+
+// exitError is the error of a subcommand which exits with its own code instead of 1.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func main() {
+	defer utils.LogPanic()
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Println(err)
+		code := 1
+		var e *exitError
+		if errors.As(err, &e) {
+			code = e.code
+		}
+		logx.Close()
+		os.Exit(code)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "config file of the subcommand, its default path under merkle_groth16/src/ if empty")
+	rootCmd.PersistentFlags().StringVar(&remotePasswdConfig, "remote-password-config", "", "mysql password secret: env:NAME, file:PATH, vault:PATH#KEY, aws:SECRET_ID?region=REGION#KEY or an aws secret id")
+}
+
+// loadConfig loads the --config file, or defaultPath without it, into config, see conf.Load.
+func loadConfig(defaultPath string, config interface{}) error {
+	path := configPath
+	if path == "" {
+		path = defaultConfigPath(defaultPath)
+	}
+	return conf.Load(path, config)
+}
+
+// defaultConfigPath resolves path, relative to the merkle_groth16 directory, against the
+// merkle_groth16 directory next to the directory of the executable, as make zkpor builds
+// build/zkpor at the repository root. It falls back to the working directory, which is
+// merkle_groth16 for go run. The paths inside the configs stay relative to the working
+// directory.
+func defaultConfigPath(path string) string {
+	executable, err := os.Executable()
+	if err == nil {
+		executable, err = filepath.EvalSymlinks(executable)
+	}
+	if err == nil {
+		resolved := filepath.Join(filepath.Dir(executable), "..", "merkle_groth16", path)
+		if _, err = os.Stat(resolved); err == nil {
+			return resolved
+		}
+	}
+	return path
+}
+
+// dataSource replaces the password of the dsn source of the db driver by the secret of
+// --remote-password-config.
+func dataSource(driver string, source string) (string, error) {
+	if remotePasswdConfig == "" {
+		return source, nil
+	}
+	return utils.GetDataSource(driver, source, remotePasswdConfig)
+}
+
+// signalContext is cancelled by SIGINT or SIGTERM, the services stop after their current step.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"merkleverifytool/merkle_groth16/src/prover/config"
+	"merkleverifytool/merkle_groth16/src/prover/prover"
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+var proveCmd = &cobra.Command{
+	Use:   "prove",
+	Short: "prove the published batch witnesses, or the cex summary",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rerun, _ := cmd.Flags().GetBool("rerun")
+		daemon, _ := cmd.Flags().GetBool("daemon")
+		summary, _ := cmd.Flags().GetBool("summary")
+		if err := prover.ValidateRunFlags(rerun, daemon); err != nil {
+			return err
+		}
+		proverConfig := &config.Config{}
+		if err := loadConfig(proverConfigPath, proverConfig); err != nil {
+			return err
+		}
+		s, err := dataSource(proverConfig.DbDriver, proverConfig.MysqlDataSource)
+		if err != nil {
+			return err
+		}
+		proverConfig.MysqlDataSource = s
+		utils.SetupLogger("prover", proverConfig.Log)
+		if summary {
+			prover.RunCexSummary(proverConfig)
+			return nil
+		}
+		ctx, stop := signalContext()
+		defer stop()
+		prover.RunService(ctx, proverConfig, rerun, daemon)
+		return nil
+	},
+}
+
+func init() {
+	proveCmd.Flags().Bool("rerun", false, "prove the witnesses whose lease expired too")
+	proveCmd.Flags().Bool("daemon", false, "wait for new witnesses until the witness service completed")
+	proveCmd.Flags().Bool("summary", false, "prove the cex summary")
+	rootCmd.AddCommand(proveCmd)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend"
+	"github.com/consensys/gnark/test"
+	"github.com/spf13/cobra"
+
+	"merkleverifytool/merkle_groth16/circuit"
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+// releasedEmptyAccountTree is the empty account leaf and tree root of the released circuits,
+// whose keys and proofs are published. The leaf and asset commitment format has changed
+// since, so the current circuits derive other values and the released keys and proofs
+// can't be reused.
+var releasedEmptyAccountTree = struct {
+	nilAccountHash string
+	root           string
+}{
+	nilAccountHash: "0cc1c37a517c3b8db148653c41b15dc7f0136dc284fb2818adf26669d897298c",
+	root:           "2787c6e55c2da2a73e57628e70386add83fd42cb4da4c401269381e918944558",
+}
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "check that the empty account leaf and tree root agree across utils, the account tree and the circuit",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Printf("asset counts %d, account tree depth %d\n", utils.AssetCounts, utils.AccountTreeDepth)
+		fmt.Printf("empty account leaf %x\n", utils.NilAccountHash)
+		fmt.Printf("empty account tree root %x\n", utils.EmptyAccountTreeRoot)
+
+		accountTree, err := utils.NewAccountTree("memory", "")
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(accountTree.Root(), utils.EmptyAccountTreeRoot) {
+			return fmt.Errorf("the root %x of an empty account tree differs from %x", accountTree.Root(), utils.EmptyAccountTreeRoot)
+		}
+		// the circuit derives the leaf and the root with its own hashing of the empty asset slots
+		err = test.IsSolved(circuit.NewEmptyAccountTreeCircuit(utils.AssetCounts, utils.AccountTreeDepth),
+			circuit.NewVerifyEmptyAccountTreeCircuit(utils.NilAccountHash, accountTree.Root()), ecc.BN254, backend.GROTH16)
+		if err != nil {
+			return fmt.Errorf("the empty account leaf and tree root of the circuit differ from %x and %x: %w",
+				utils.NilAccountHash, accountTree.Root(), err)
+		}
+		released := releasedEmptyAccountTree
+		if hex.EncodeToString(utils.NilAccountHash) != released.nilAccountHash ||
+			hex.EncodeToString(utils.EmptyAccountTreeRoot) != released.root {
+			fmt.Printf("the empty account leaf and tree root differ from the released %s and %s, "+
+				"the keys, witnesses, proofs and user proofs of the release must be regenerated\n", released.nilAccountHash, released.root)
+		}
+		fmt.Println("selftest passed")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+}
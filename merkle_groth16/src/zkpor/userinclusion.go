@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"merkleverifytool/merkle_groth16/src/userinclusion/config"
+	"merkleverifytool/merkle_groth16/src/userinclusion/userinclusion"
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/verifier/verifier"
+)
+
+var userInclusionCmd = &cobra.Command{
+	Use:   "userinclusion",
+	Short: "prove or verify that a user is in the account tree with claimed minimum balances",
+}
+
+// loadUserInclusionConfig loads the userinclusion config and sets up the logger.
+func loadUserInclusionConfig() (*config.Config, error) {
+	userInclusionConfig := &config.Config{}
+	if err := loadConfig(userInclusionConfigPath, userInclusionConfig); err != nil {
+		return nil, err
+	}
+	utils.SetupLogger("userinclusion", userInclusionConfig.Log)
+	return userInclusionConfig, nil
+}
+
+var userInclusionProveCmd = &cobra.Command{
+	Use:   "prove",
+	Short: "prove the Claims of the config for the user proof of UserConfigFile into ProofFile",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		userInclusionConfig, err := loadUserInclusionConfig()
+		if err != nil {
+			return err
+		}
+		return userinclusion.Prove(userInclusionConfig)
+	},
+}
+
+var userInclusionVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "verify ProofFile with the verifying keys pinned in VerifyingKeyHashes",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		userInclusionConfig, err := loadUserInclusionConfig()
+		if err != nil {
+			return err
+		}
+		userInclusionProof, err := userinclusion.Verify(userInclusionConfig)
+		if err != nil {
+			return &exitError{code: verifier.VerifyExitCode(err), err: err}
+		}
+		fmt.Println(userInclusionProof)
+		fmt.Println("user inclusion proof verify passed!!!")
+		return nil
+	},
+}
+
+func init() {
+	userInclusionCmd.AddCommand(userInclusionProveCmd, userInclusionVerifyCmd)
+	rootCmd.AddCommand(userInclusionCmd)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"merkleverifytool/merkle_groth16/src/userproof/config"
+	"merkleverifytool/merkle_groth16/src/userproof/userproof"
+	"merkleverifytool/merkle_groth16/src/utils"
+)
+
+var userproofCmd = &cobra.Command{
+	Use:   "userproof",
+	Short: "write the merkle proofs of the accounts into the userproof table",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		memoryTree, _ := cmd.Flags().GetBool("memory-tree")
+		userProofConfig := &config.Config{}
+		if err := loadConfig(userproofConfigPath, userProofConfig); err != nil {
+			return err
+		}
+		s, err := dataSource(userProofConfig.DbDriver, userProofConfig.MysqlDataSource)
+		if err != nil {
+			return err
+		}
+		userProofConfig.MysqlDataSource = s
+		utils.SetupLogger("userproof", userProofConfig.Log)
+		ctx, stop := signalContext()
+		defer stop()
+		userproof.RunService(ctx, userProofConfig, memoryTree)
+		return nil
+	},
+}
+
+func init() {
+	userproofCmd.Flags().Bool("memory-tree", true, "construct the account tree in memory instead of the tree db")
+	rootCmd.AddCommand(userproofCmd)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"merkleverifytool/merkle_groth16/src/bundle"
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/verifier/config"
+	"merkleverifytool/merkle_groth16/src/verifier/verifier"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "verify the batch proofs, a user proof or the cex summary proof",
+}
+
+var verifyBatchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "verify the batch proofs and the cex assets of the verifier config or of a signed bundle",
+	Long: `verify the batch proofs and the cex assets of the verifier config or of a signed bundle,
+exiting with 0 if all batches pass, 1 if the verification can't run, 2 for missing or duplicate
+batches, 3 for malformed batches and 4 for invalid batches or final cex assets.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bundlePath, _ := cmd.Flags().GetString("bundle")
+		keyDir, _ := cmd.Flags().GetString("key-dir")
+		publicKeyFlag, _ := cmd.Flags().GetString("public-key")
+		unsigned, _ := cmd.Flags().GetBool("unsigned")
+		verifierConfig := &config.Config{}
+		if bundlePath != "" {
+			var publicKey ed25519.PublicKey
+			if publicKeyFlag != "" {
+				var err error
+				publicKey, err = bundle.LoadPublicKey(publicKeyFlag)
+				if err != nil {
+					return err
+				}
+			} else if !unsigned {
+				return errors.New("--public-key of the exchange is required to check the bundle signature, or --unsigned to skip it")
+			}
+			manifest, dir, cleanup, err := bundle.Open(bundlePath, publicKey)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			verifierConfig = manifest.VerifierConfig(dir, keyDir)
+		} else if err := loadConfig(verifierConfigPath, verifierConfig); err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("workers") {
+			verifierConfig.Workers, _ = cmd.Flags().GetInt("workers")
+		}
+		if cmd.Flags().Changed("checkpoint") {
+			verifierConfig.CheckpointFile, _ = cmd.Flags().GetString("checkpoint")
+		}
+		if err := verifierConfig.Validate(); err != nil {
+			return err
+		}
+		utils.SetupLogger("verifier", verifierConfig.Log)
+		report, err := verifier.VerifyBatches(verifierConfig)
+		if err != nil {
+			return err
+		}
+		if !report.Passed() {
+			return &exitError{code: verifier.ExitCode(report, nil), err: errors.New(report.String())}
+		}
+		fmt.Println(report)
+		return nil
+	},
+}
+
+var verifyUserCmd = &cobra.Command{
+	Use:   "user",
+	Short: "verify the merkle proof of a user",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		userConfig := &config.UserConfig{}
+		if err := loadConfig(verifierUserConfigPath, userConfig); err != nil {
+			return err
+		}
+		utils.SetupLogger("verifier", utils.LogConfig{})
+		if err := verifier.VerifyUser(userConfig); err != nil {
+			return &exitError{code: verifier.VerifyExitCode(err), err: err}
+		}
+		return nil
+	},
+}
+
+var verifySummaryCmd = &cobra.Command{
+	Use:   "summary",
+	Short: "verify the cex summary proof",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verifierConfig := &config.Config{}
+		if err := loadConfig(verifierConfigPath, verifierConfig); err != nil {
+			return err
+		}
+		utils.SetupLogger("verifier", verifierConfig.Log)
+		if err := verifier.VerifyCexSummary(verifierConfig); err != nil {
+			return &exitError{code: verifier.VerifyExitCode(err), err: err}
+		}
+		return nil
+	},
+}
+
+func init() {
+	verifyBatchCmd.Flags().String("bundle", "", "archive or directory of a proof bundle written by export, instead of the verifier config")
+	verifyBatchCmd.Flags().String("public-key", "", "hex of the ed25519 public key of the exchange, or a file of it, which signed the bundle")
+	verifyBatchCmd.Flags().Bool("unsigned", false, "skip the signature check of the bundle")
+	verifyBatchCmd.Flags().Int("workers", 0, "concurrent batch proof verifications, the cpu cores if 0, Workers of the config if not set")
+	verifyBatchCmd.Flags().String("checkpoint", "", "file recording the verified batches to resume an interrupted verification from, CheckpointFile of the config if not set")
+	verifyBatchCmd.Flags().String("key-dir", "", "directory of the verifying keys, the keys of the bundle if not set")
+	verifyCmd.AddCommand(verifyBatchCmd, verifyUserCmd, verifySummaryCmd)
+	rootCmd.AddCommand(verifyCmd)
+}
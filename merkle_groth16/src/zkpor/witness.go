@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"merkleverifytool/merkle_groth16/src/utils"
+	"merkleverifytool/merkle_groth16/src/witness/config"
+	"merkleverifytool/merkle_groth16/src/witness/witness"
+)
+
+var witnessCmd = &cobra.Command{
+	Use:   "witness",
+	Short: "build the account tree and publish the batch witnesses",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		witnessConfig := &config.Config{}
+		if err := loadConfig(witnessConfigPath, witnessConfig); err != nil {
+			return err
+		}
+		s, err := dataSource(witnessConfig.DbDriver, witnessConfig.MysqlDataSource)
+		if err != nil {
+			return err
+		}
+		witnessConfig.MysqlDataSource = s
+		utils.SetupLogger("witness", witnessConfig.Log)
+		ctx, stop := signalContext()
+		defer stop()
+		witness.RunService(ctx, witnessConfig)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(witnessCmd)
+}